@@ -0,0 +1,159 @@
+//go:build e2e
+// +build e2e
+
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	scepserver "go.bog.dev/scep2acme/internal/scepserver"
+
+	"go.bog.dev/scep2acme/internal/acme"
+	"go.bog.dev/scep2acme/internal/config"
+	"go.bog.dev/scep2acme/internal/e2etest"
+	scepdepot "go.bog.dev/scep2acme/internal/scep"
+	"go.bog.dev/scep2acme/internal/store"
+	"go.bog.dev/scep2acme/internal/whitelist"
+)
+
+// TestSCEPWorkflowAgainstPebble drives a real SCEP enrollment
+// (the actual wire format, not a mock) against a scep2acme
+// server wired to a local Pebble instance: the CSR is forwarded to ACME,
+// the DNS-01 challenge is solved through pebble-challtestsrv, and the
+// resulting certificate comes back over SCEP. It also covers the failure
+// paths that are otherwise only reachable against Let's Encrypt staging: a
+// whitelist rejection, and a DNS-01 challenge that never propagates.
+//
+// It replaces the old TestSCEPWorkflowWithVault/TestSCEPWorkflowWithOpenBao
+// placeholders in integration_test.go, which never drove a SCEP client.
+func TestSCEPWorkflowAgainstPebble(t *testing.T) {
+	harness := e2etest.New(t)
+
+	const (
+		allowedPassword = "s3cr3t"
+		allowedName     = "allowed.acme.localhost"
+		pendingName     = "pending.acme.localhost"
+		deniedName      = "denied.acme.localhost"
+	)
+
+	dir := t.TempDir()
+
+	whitelistPath := filepath.Join(dir, "whitelist.yaml")
+	whitelistYAML := allowedPassword + ":\n  - " + allowedName + "\n  - " + pendingName + "\n"
+	if err := os.WriteFile(whitelistPath, []byte(whitelistYAML), 0o600); err != nil {
+		t.Fatalf("writing whitelist: %v", err)
+	}
+
+	verifier, err := whitelist.NewCSRPasswordVerifier(whitelistPath)
+	if err != nil {
+		t.Fatalf("loading whitelist: %v", err)
+	}
+
+	dnsScript, err := e2etest.UpdateDNSScript()
+	if err != nil {
+		t.Fatalf("locating dns exec script: %v", err)
+	}
+	t.Setenv("LEGO_CA_CERTIFICATES", harness.CACertPath())
+	t.Setenv("EXEC_PATH", dnsScript)
+	t.Setenv("EXEC_PROPAGATION_TIMEOUT", "5")
+	t.Setenv("EXEC_POLLING_INTERVAL", "1")
+	t.Setenv("SCEP2ACME_DNS01_RESOLVERS", e2etest.DNS01Resolver)
+	t.Setenv("SCEP2ACME_DNS01_DISABLE_CP", "1")
+
+	acmeKeyPEM, err := generateTestACMEKey()
+	if err != nil {
+		t.Fatalf("generating acme account key: %v", err)
+	}
+	acmeKeyPath := filepath.Join(dir, "acme.key")
+	if err := os.WriteFile(acmeKeyPath, acmeKeyPEM, 0o600); err != nil {
+		t.Fatalf("writing acme account key: %v", err)
+	}
+
+	acmeClient, err := acme.NewClient("e2e@example.com", acmeKeyPath, filepath.Join(dir, "acme.account.json"),
+		e2etest.DirectoryURL, config.ChallengeDNS01, "exec", "", "", "", 0, false)
+	if err != nil {
+		t.Fatalf("creating acme client: %v", err)
+	}
+
+	caPEM, raPEM, caKeyPEM, raKeyPEM, err := generateTestCAAndRA()
+	if err != nil {
+		t.Fatalf("generating RA/CA cert chain: %v", err)
+	}
+	certPath := filepath.Join(dir, "ra.pem")
+	if err := os.WriteFile(certPath, append(raPEM, caPEM...), 0o600); err != nil {
+		t.Fatalf("writing RA/CA cert chain: %v", err)
+	}
+	_ = caKeyPEM // the CA key only exists to sign the RA cert above
+	raKeyPath := filepath.Join(dir, "ra.key")
+	if err := os.WriteFile(raKeyPath, raKeyPEM, 0o600); err != nil {
+		t.Fatalf("writing RA key: %v", err)
+	}
+
+	depot, err := scepdepot.NewDepot(certPath, raKeyPath)
+	if err != nil {
+		t.Fatalf("creating scep depot: %v", err)
+	}
+
+	certSource := acmeClient.NewStoredSource(store.NewMemoryStore())
+
+	svc, err := scepserver.NewService(depot,
+		scepserver.WithCSRVerifier(verifier),
+		scepserver.WithCertificateSource(certSource),
+		scepserver.WithLogger(log.NewNopLogger()))
+	if err != nil {
+		t.Fatalf("creating scep service: %v", err)
+	}
+
+	ts := httptest.NewServer(scepserver.MakeHTTPHandler(scepserver.MakeServerEndpoints(svc), svc, log.NewNopLogger()))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	t.Run("happy path", func(t *testing.T) {
+		// lego's "exec" DNS-01 provider (EXEC_PATH=update-dns.sh) publishes
+		// and retracts the actual challenge TXT record itself via
+		// pebble-challtestsrv's management API - nothing to set up here.
+		result, err := e2etest.Enroll(ctx, ts.URL+"/scep", allowedName, allowedPassword)
+		if err != nil {
+			t.Fatalf("enrolling %s: %v", allowedName, err)
+		}
+		if result.Certificate == nil {
+			t.Fatalf("enrolling %s: status=%s failInfo=%s, want a certificate", allowedName, result.Status, result.FailInfo)
+		}
+		if result.Certificate.Subject.CommonName != allowedName {
+			t.Errorf("issued cert CN = %q, want %q", result.Certificate.Subject.CommonName, allowedName)
+		}
+	})
+
+	t.Run("whitelist reject", func(t *testing.T) {
+		result, err := e2etest.Enroll(ctx, ts.URL+"/scep", deniedName, allowedPassword)
+		if err != nil {
+			t.Fatalf("enrolling %s: %v", deniedName, err)
+		}
+		if result.Certificate != nil {
+			t.Fatalf("enrolling %s: got a certificate, want a whitelist rejection", deniedName)
+		}
+	})
+
+	t.Run("dns challenge timeout", func(t *testing.T) {
+		// pendingName is whitelisted but its TXT record is never published,
+		// so DNS-01 propagation checking times out and ObtainForCSR fails
+		// before an order is even submitted to ACME.
+		_, err := e2etest.Enroll(ctx, ts.URL+"/scep", pendingName, allowedPassword)
+		if err == nil {
+			t.Fatalf("enrolling %s: got no error, want a DNS-01 propagation timeout", pendingName)
+		}
+	})
+}
+
+// acmeChallengeFQDN is the DNS-01 TXT record name for domain.
+func acmeChallengeFQDN(domain string) string {
+	return "_acme-challenge." + domain + "."
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.bog.dev/scep2acme/internal/pki"
+)
+
+// keyTypeUsage documents the -cakeytype/-rakeytype flag values shared by
+// init-ra and renew-ra.
+const keyTypeUsage = "Key type: rsa2048, rsa3072, rsa4096, ecdsa-p256 or ecdsa-p384"
+
+// runInitRA implements the `scep2acme init-ra` subcommand: mints a
+// self-signed CA and an RA certificate signed by it, then writes ca.pem,
+// ca.key, ra.pem, the combined ra+ca.pem and ra.key to -out.
+func runInitRA(args []string) {
+	fs := flag.NewFlagSet("init-ra", flag.ExitOnError)
+	var (
+		out            = fs.String("out", ".", "Output directory for ca.pem, ca.key, ra.pem, ra+ca.pem and ra.key")
+		caKeyType      = fs.String("cakeytype", string(pki.RSA3072), keyTypeUsage)
+		raKeyType      = fs.String("rakeytype", string(pki.RSA2048), keyTypeUsage)
+		caValidity     = fs.Duration("cavalidity", 10*365*24*time.Hour, "CA certificate validity")
+		raValidity     = fs.Duration("ravalidity", 2*365*24*time.Hour, "RA certificate validity")
+		caCommonName   = fs.String("cacn", "scep2acme RA CA", "CA certificate CommonName")
+		raCommonName   = fs.String("racn", "scep2acme RA", "RA certificate CommonName")
+		organization   = fs.String("organization", "", "Organization set on both the CA and RA certificate subject")
+		country        = fs.String("country", "", "Country set on both the CA and RA certificate subject")
+		maxPathLen     = fs.Int("max-path-len", -1, "CA BasicConstraints pathLenConstraint (-1 omits it)")
+		maxPathLenZero = fs.Bool("max-path-len-zero", false, "Encode an explicit pathLenConstraint of 0, forbidding intermediate CAs (distinct from omitting it via -max-path-len=-1)")
+		san            = fs.String("san", "", "Comma-separated hostname/IP Subject Alternative Names for the RA certificate")
+	)
+	fs.Parse(args)
+
+	// x509.CreateCertificate only encodes MaxPathLenZero when MaxPathLen is
+	// 0 - with -max-path-len left at its default of -1, -max-path-len-zero
+	// would otherwise be silently ignored. -max-path-len=0 already implies
+	// the same pathLenConstraint, so only reject an explicit, contradictory
+	// non-zero value.
+	if *maxPathLenZero && *maxPathLen != -1 && *maxPathLen != 0 {
+		panic(fmt.Sprintf("-max-path-len-zero conflicts with -max-path-len=%d", *maxPathLen))
+	}
+	if *maxPathLenZero {
+		*maxPathLen = 0
+	}
+
+	dnsNames, ips := splitSANs(*san)
+
+	ca, caKey, err := pki.CreateCA(pki.CAOptions{
+		KeyType:        pki.KeyType(*caKeyType),
+		Subject:        pki.Subject{CommonName: *caCommonName, Organization: *organization, Country: *country},
+		Validity:       *caValidity,
+		MaxPathLen:     *maxPathLen,
+		MaxPathLenZero: *maxPathLenZero,
+	})
+	if err != nil {
+		panic(fmt.Errorf("creating CA: %w", err))
+	}
+
+	ra, raKey, err := pki.CreateRA(ca, caKey, pki.RAOptions{
+		KeyType:     pki.KeyType(*raKeyType),
+		Subject:     pki.Subject{CommonName: *raCommonName, Organization: *organization, Country: *country},
+		Validity:    *raValidity,
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	})
+	if err != nil {
+		panic(fmt.Errorf("creating RA: %w", err))
+	}
+
+	if err := pki.WriteBundle(*out, ca, caKey, ra, raKey); err != nil {
+		panic(fmt.Errorf("writing pki bundle: %w", err))
+	}
+
+	fmt.Printf("wrote CA and RA certificates and keys to %s\n", *out)
+}
+
+// splitSANs parses a comma-separated -san value into the DNS names and IP
+// addresses x509.Certificate.DNSNames/IPAddresses need split apart into.
+func splitSANs(csv string) (dnsNames []string, ips []net.IP) {
+	for _, s := range strings.Split(csv, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if ip := net.ParseIP(s); ip != nil {
+			ips = append(ips, ip)
+			continue
+		}
+		dnsNames = append(dnsNames, s)
+	}
+	return dnsNames, ips
+}
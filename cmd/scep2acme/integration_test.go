@@ -404,41 +404,11 @@ func testACMEDirectory(url string) error {
 	return nil
 }
 
-// TestSCEPWorkflowWithVault tests the full SCEP workflow with Vault backend
-func TestSCEPWorkflowWithVault(t *testing.T) {
-	config := setupIntegrationTest(t)
-	defer cleanupIntegrationTest(config)
-	
-	// Setup Vault PKI
-	setupVaultPKI(t, config)
-	
-	// This test would involve:
-	// 1. Starting the SCEP2ACME server with Vault ACME backend
-	// 2. Creating a SCEP client
-	// 3. Performing SCEP enrollment
-	// 4. Verifying the certificate was issued by Vault
-	
-	// For now, we'll test the component integration
-	t.Logf("SCEP workflow with Vault test placeholder - full implementation requires SCEP client")
-}
-
-// TestSCEPWorkflowWithOpenBao tests the full SCEP workflow with OpenBao backend
-func TestSCEPWorkflowWithOpenBao(t *testing.T) {
-	config := setupIntegrationTest(t)
-	defer cleanupIntegrationTest(config)
-	
-	// Setup OpenBao PKI
-	setupOpenBaoPKI(t, config)
-	
-	// This test would involve:
-	// 1. Starting the SCEP2ACME server with OpenBao ACME backend
-	// 2. Creating a SCEP client
-	// 3. Performing SCEP enrollment
-	// 4. Verifying the certificate was issued by OpenBao
-	
-	// For now, we'll test the component integration
-	t.Logf("SCEP workflow with OpenBao test placeholder - full implementation requires SCEP client")
-}
+// The Vault/OpenBao-backed SCEP workflow placeholders that used to live
+// here (TestSCEPWorkflowWithVault, TestSCEPWorkflowWithOpenBao) never drove
+// an actual SCEP client - see e2e_test.go (build tag "e2e") for tests that
+// exercise the real enroll-CSR-via-ACME-via-SCEP path end-to-end, against a
+// local Pebble instance rather than Vault/OpenBao's ACME directories.
 
 // TestCSRCreation tests creating CSRs for SCEP enrollment
 func TestCSRCreation(t *testing.T) {
@@ -1,26 +1,84 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
-	scepserver "github.com/micromdm/scep/server"
+	scepserver "go.bog.dev/scep2acme/internal/scepserver"
 
 	"go.bog.dev/scep2acme/internal/acme"
 	"go.bog.dev/scep2acme/internal/config"
+	"go.bog.dev/scep2acme/internal/keyprovider"
 	"go.bog.dev/scep2acme/internal/scep"
 	"go.bog.dev/scep2acme/internal/server"
+	"go.bog.dev/scep2acme/internal/store"
 	"go.bog.dev/scep2acme/internal/whitelist"
 )
 
+// raKeyPassphraseEnv is the environment variable loadRAKeyPassphrase falls
+// back to when -ra-key-passphrase-file isn't set.
+const raKeyPassphraseEnv = "SCEP2ACME_RA_KEY_PASSPHRASE"
+
+// loadRAKeyPassphrase resolves the passphrase decrypting an encrypted
+// -certkey or -ra-pkcs12, preferring passphraseFile (-ra-key-passphrase-file)
+// over raKeyPassphraseEnv; nil if neither is set, for an unencrypted key.
+func loadRAKeyPassphrase(passphraseFile string) ([]byte, error) {
+	if passphraseFile != "" {
+		data, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", passphraseFile, err)
+		}
+		return bytes.TrimRight(data, "\r\n"), nil
+	}
+	if v, ok := os.LookupEnv(raKeyPassphraseEnv); ok {
+		return []byte(v), nil
+	}
+	return nil, nil
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "init-ra":
+			runInitRA(os.Args[2:])
+			return
+		case "renew-ra":
+			runRenewRA(os.Args[2:])
+			return
+		}
+	}
+
 	cfg := config.ParseFlags()
 	cfg.Validate()
 
-	// Setup ACME client
-	acmeClient, err := acme.NewClient(cfg.ACMEEmail, cfg.ACMEKeyPath, cfg.ACMEURL, cfg.DNSProvider)
+	// Setup ACME clients: one per profile in -profiles, plus the default
+	// profile built from the top-level -acme* flags.
+	var profiles acme.ProfilesConfig
+	if cfg.ProfilesPath != "" {
+		var err error
+		profiles, err = acme.LoadProfilesConfig(cfg.ProfilesPath)
+		if err != nil {
+			panic(fmt.Errorf("loading acme profiles: %w", err))
+		}
+	}
+
+	acmeClients, err := acme.NewClients(acme.ProfileConfig{
+		ACMEEmail:             cfg.ACMEEmail,
+		ACMEKeyPath:           cfg.ACMEKeyPath,
+		ACMEAccountPath:       cfg.ACMEAccountPath,
+		ACMEURL:               cfg.ACMEURL,
+		Challenge:             cfg.Challenge,
+		DNSProvider:           cfg.DNSProvider,
+		DNSProvidersPath:      cfg.DNSProvidersPath,
+		HTTPChallengePort:     cfg.HTTPChallengePort,
+		TLSALPNChallengePort:  cfg.TLSALPNChallengePort,
+		DNSSequentialInterval: cfg.DNSSequentialInterval,
+		SkipPropagationCheck:  cfg.SkipPropagationCheck,
+	}, profiles)
 	if err != nil {
 		panic(err)
 	}
@@ -37,31 +95,89 @@ func main() {
 	}
 
 	// Setup CSR verifier
-	verifier, err := whitelist.NewCSRPasswordVerifier(cfg.WhitelistPath)
+	verifierOptions := []whitelist.Option{
+		whitelist.WithLogger(log.With(logger, "component", "whitelist")),
+	}
+	if cfg.AuditLogPath != "" {
+		auditSink, err := whitelist.NewFileAuditSink(cfg.AuditLogPath)
+		if err != nil {
+			panic(fmt.Errorf("setting up audit log: %w", err))
+		}
+		verifierOptions = append(verifierOptions, whitelist.WithAuditSink(auditSink))
+	}
+	verifier, err := whitelist.NewCSRPasswordVerifier(cfg.WhitelistPath, verifierOptions...)
 	if err != nil {
 		panic(fmt.Errorf("loading whitelist: %w", err))
 	}
 
-	// Setup SCEP service
-	depot := scep.NewDepot(cfg.CertPath, cfg.CertKeyPath)
+	// Persist issued certificates so repeated SCEP requests for the same
+	// hostnames - including retries of an identical CSR while challenge
+	// validation is pending - are served from the store instead of each
+	// triggering its own ACME order, and so a background Renewer can keep
+	// them fresh.
+	var certStore store.Store
+	if cfg.StorePath != "" {
+		certStore, err = store.NewFileStore(cfg.StorePath)
+		if err != nil {
+			panic(fmt.Errorf("setting up certificate store: %w", err))
+		}
+	} else {
+		certStore = store.NewMemoryStore()
+	}
+	var certSource scepserver.CertificateSource
+	if cfg.ProfilesPath != "" {
+		certSource = acme.NewRoutedStoredSource(acmeClients, verifier, certStore)
+	} else {
+		certSource = acmeClients[whitelist.DefaultProfile].NewStoredSource(certStore)
+	}
+	renewer := acme.NewRenewer(acmeClients, certStore, log.With(level.Info(logger), "component", "renewer"))
+
+	// Setup SCEP service. The RA key/cert chain come from a single PKCS#12
+	// bundle if -ra-pkcs12 is set, or -cert resolves to one by extension;
+	// otherwise from the PEM -cert chain plus the -certkey key.
+	raKeyPassphrase, err := loadRAKeyPassphrase(cfg.RAKeyPassphraseFile)
+	if err != nil {
+		panic(fmt.Errorf("loading RA key passphrase: %w", err))
+	}
+
+	pkcs12Path := cfg.RAPKCS12Path
+	if pkcs12Path == "" && scep.IsPKCS12Path(cfg.CertPath) {
+		pkcs12Path = cfg.CertPath
+	}
+
+	var depot *scep.Depot
+	if pkcs12Path != "" {
+		depot = scep.NewDepotFromPKCS12(pkcs12Path, raKeyPassphrase)
+	} else {
+		var keyOpts []keyprovider.FileOption
+		if len(raKeyPassphrase) > 0 {
+			keyOpts = append(keyOpts, keyprovider.WithPassphrase(raKeyPassphrase))
+		}
+		depot, err = scep.NewDepot(cfg.CertPath, cfg.CertKeyPath, keyOpts...)
+		if err != nil {
+			panic(err)
+		}
+	}
 	var svc scepserver.Service
 	{
 		svcOptions := []scepserver.ServiceOption{
 			scepserver.WithLogger(logger),
 			scepserver.WithCSRVerifier(verifier),
-			scepserver.WithCertificateSource(acmeClient.CertificateSource()),
+			scepserver.WithCertificateSource(certSource),
 		}
 		svc, err = scepserver.NewService(depot, svcOptions...)
 		if err != nil {
 			panic(err)
 		}
-		svc = scep.ServiceWithoutRenewal{Service: svc}
 		svc = scepserver.NewLoggingService(log.With(level.Info(logger), "component", "scep_service"), svc)
 	}
 
 	// Start server
-	srv := server.New(cfg.ListenPort, logger)
-	if err := srv.Run(svc); err != nil {
+	srv := server.New(cfg.ListenPort, logger, verifier)
+	renew := func(ctx context.Context) error {
+		return renewer.Run(ctx, cfg.RenewInterval)
+	}
+	if err := srv.Run(svc, renew); err != nil {
 		panic(err)
 	}
 }
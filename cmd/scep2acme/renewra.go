@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"go.bog.dev/scep2acme/internal/keyprovider"
+	"go.bog.dev/scep2acme/internal/pki"
+)
+
+// runRenewRA implements the `scep2acme renew-ra` subcommand: re-signs the RA
+// certificate at -ra against the CA at -ca/-cakey, reusing its CommonName
+// and SANs unless overridden, writing the renewed ra.pem, ra+ca.pem and
+// ra.key to -out. It's a no-op unless the existing RA certificate is within
+// -within of expiry, or -force is set.
+func runRenewRA(args []string) {
+	fs := flag.NewFlagSet("renew-ra", flag.ExitOnError)
+	var (
+		caPath       = fs.String("ca", "ca.pem", "Path to the existing CA certificate")
+		caKeyURI     = fs.String("cakey", "", "CA private key, as a path/file:// URI, or a pkcs11:// or tpm:// URI (mandatory)")
+		raPath       = fs.String("ra", "ra.pem", "Path to the existing RA certificate, checked against -within")
+		out          = fs.String("out", ".", "Output directory for the renewed ra.pem, ra+ca.pem and ra.key")
+		raKeyType    = fs.String("rakeytype", string(pki.RSA2048), keyTypeUsage)
+		raValidity   = fs.Duration("ravalidity", 2*365*24*time.Hour, "Renewed RA certificate validity")
+		raCommonName = fs.String("racn", "", "RA certificate CommonName (default: reuse the existing RA certificate's)")
+		within       = fs.Duration("within", 30*24*time.Hour, "Only renew if the existing RA certificate expires within this long")
+		force        = fs.Bool("force", false, "Renew even if the existing RA certificate isn't within -within of expiry")
+	)
+	fs.Parse(args)
+
+	if *caKeyURI == "" {
+		panic("-cakey is mandatory, use -help for help")
+	}
+
+	ca, err := pki.LoadCertificate(*caPath)
+	if err != nil {
+		panic(fmt.Errorf("loading CA certificate: %w", err))
+	}
+
+	existingRA, err := pki.LoadCertificate(*raPath)
+	if err != nil {
+		panic(fmt.Errorf("loading existing RA certificate: %w", err))
+	}
+
+	if !*force && !pki.NeedsRenewal(existingRA, *within) {
+		fmt.Printf("RA certificate %s does not expire within %s, not renewing (use -force to override)\n", *raPath, *within)
+		return
+	}
+
+	caKeyProvider, err := keyprovider.New(*caKeyURI)
+	if err != nil {
+		panic(fmt.Errorf("setting up CA key: %w", err))
+	}
+	caKey, err := caKeyProvider.Signer(context.Background())
+	if err != nil {
+		panic(fmt.Errorf("loading CA key: %w", err))
+	}
+
+	subject := pki.Subject{CommonName: existingRA.Subject.CommonName}
+	if *raCommonName != "" {
+		subject.CommonName = *raCommonName
+	}
+	if len(existingRA.Subject.Organization) > 0 {
+		subject.Organization = existingRA.Subject.Organization[0]
+	}
+	if len(existingRA.Subject.Country) > 0 {
+		subject.Country = existingRA.Subject.Country[0]
+	}
+
+	ra, raKey, err := pki.CreateRA(ca, caKey, pki.RAOptions{
+		KeyType:     pki.KeyType(*raKeyType),
+		Subject:     subject,
+		Validity:    *raValidity,
+		DNSNames:    existingRA.DNSNames,
+		IPAddresses: existingRA.IPAddresses,
+	})
+	if err != nil {
+		panic(fmt.Errorf("creating renewed RA: %w", err))
+	}
+
+	if err := pki.WriteRABundle(*out, ra, ca, raKey); err != nil {
+		panic(fmt.Errorf("writing renewed RA bundle: %w", err))
+	}
+
+	fmt.Printf("renewed RA certificate, wrote ra.pem, ra+ca.pem and ra.key to %s\n", *out)
+}
@@ -0,0 +1,95 @@
+package acme
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-acme/lego/v4/registration"
+	josejwk "github.com/go-jose/go-jose/v4"
+)
+
+// accountRecord is the on-disk representation of a persisted ACME account.
+// It is written next to the account key so that restarts can reuse the
+// existing registration instead of hitting the CA's newAccount endpoint.
+type accountRecord struct {
+	Email         string                 `json:"email"`
+	CADirURL      string                 `json:"ca_dir_url"`
+	KeyThumbprint string                 `json:"key_thumbprint"`
+	Registration  *registration.Resource `json:"registration"`
+}
+
+// loadAccount reads a persisted account record from path. It returns the
+// usual os.ReadFile error (including os.ErrNotExist) if the file is missing.
+func loadAccount(path string) (*accountRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rec accountRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("parsing account file: %w", err)
+	}
+
+	return &rec, nil
+}
+
+// saveAccount atomically persists an account record to path using a
+// temp-file-then-rename so a crash mid-write can't corrupt the file a
+// concurrent reader depends on. The file is restricted to the owner since
+// it contains the account's registration URI.
+func saveAccount(path string, rec *accountRecord) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding account file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating temp account file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing account file: %w", err)
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("chmod account file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing account file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// keyThumbprint computes the base64url-encoded SHA-256 JWK thumbprint of an
+// account private key. It's stored alongside the registration so a changed
+// --acmekey is detected and triggers a fresh registration instead of reusing
+// someone else's account.
+func keyThumbprint(key crypto.PrivateKey) (string, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", fmt.Errorf("account key does not implement crypto.Signer")
+	}
+
+	jwk := &josejwk.JSONWebKey{Key: signer.Public()}
+	thumb, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("computing key thumbprint: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(thumb), nil
+}
+
+// defaultAccountPath derives the account file path from the account key path
+// when --acmeaccount isn't set explicitly.
+func defaultAccountPath(keyPath string) string {
+	return keyPath + ".account.json"
+}
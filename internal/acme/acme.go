@@ -7,13 +7,22 @@ import (
 	"encoding/pem"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/go-acme/lego/v4/challenge/http01"
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
 	"github.com/go-acme/lego/v4/lego"
 	"github.com/go-acme/lego/v4/providers/dns"
 	"github.com/go-acme/lego/v4/registration"
-	"github.com/micromdm/scep/scep"
-	scepserver "github.com/micromdm/scep/server"
+	"github.com/smallstep/scep"
+	scepserver "go.bog.dev/scep2acme/internal/scepserver"
+
+	"go.bog.dev/scep2acme/internal/config"
+	"go.bog.dev/scep2acme/internal/reqid"
 )
 
 // UserInfo holds ACME user information
@@ -64,10 +73,28 @@ func (u *UserInfo) GetPrivateKey() crypto.PrivateKey {
 // Client wraps a lego ACME client
 type Client struct {
 	*lego.Client
+	user *UserInfo
+}
+
+// GetRegistration returns the ACME account registration used by c, for
+// persisting alongside certificates issued with it.
+func (c *Client) GetRegistration() *registration.Resource {
+	return c.user.GetRegistration()
 }
 
-// NewClient creates a new ACME client
-func NewClient(email, keyPath, acmeURL, dnsProvider string) (*Client, error) {
+// NewClient creates a new ACME client. accountPath points at the JSON file
+// used to persist the account registration across restarts; if empty, it
+// defaults to a companion file next to keyPath. challengeType selects which
+// of the three challenge types (config.ChallengeDNS01, ChallengeHTTP01 or
+// ChallengeTLSALPN01) lego solves orders with. dnsProvidersPath, if set,
+// points at a --dnsproviders YAML file routing DNS-01 challenges to
+// different providers per hostname suffix, falling back to dnsProvider for
+// any FQDN it doesn't cover; if empty, dnsProvider is used for everything.
+// httpPort and tlsALPNPort are only used by the HTTP-01 and TLS-ALPN-01
+// challenge types, respectively. dnsSequentialInterval and
+// skipPropagationCheck only affect the DNS-01 challenge type - see
+// setupDNS01.
+func NewClient(email, keyPath, accountPath, acmeURL, challengeType, dnsProvider, dnsProvidersPath, httpPort, tlsALPNPort string, dnsSequentialInterval time.Duration, skipPropagationCheck bool) (*Client, error) {
 	acmeUser := NewUserInfo(email, keyPath)
 	acmeConfig := lego.NewConfig(acmeUser)
 	acmeConfig.CADirURL = acmeURL
@@ -77,22 +104,156 @@ func NewClient(email, keyPath, acmeURL, dnsProvider string) (*Client, error) {
 		return nil, fmt.Errorf("creating acme client: %w", err)
 	}
 
-	provider, err := dns.NewDNSChallengeProviderByName(dnsProvider)
+	switch challengeType {
+	case config.ChallengeDNS01:
+		if err := setupDNS01(client, dnsProvider, dnsProvidersPath, dnsSequentialInterval, skipPropagationCheck); err != nil {
+			return nil, err
+		}
+	case config.ChallengeHTTP01:
+		// NewProviderServer binds its own listener for the duration of each
+		// order's Present/CleanUp, scoped to the SCEP request that triggered
+		// it - it needs no separate entry in the server's shutdown pool.
+		if err := client.Challenge.SetHTTP01Provider(http01.NewProviderServer("", httpPort)); err != nil {
+			return nil, fmt.Errorf("setting challenge provider: %w", err)
+		}
+	case config.ChallengeTLSALPN01:
+		if err := client.Challenge.SetTLSALPN01Provider(tlsalpn01.NewProviderServer("", tlsALPNPort)); err != nil {
+			return nil, fmt.Errorf("setting challenge provider: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported challenge type %q", challengeType)
+	}
+
+	if accountPath == "" {
+		accountPath = defaultAccountPath(keyPath)
+	}
+
+	acmeUser.registration, err = loadOrRegisterAccount(client, acmeUser, accountPath, acmeURL)
 	if err != nil {
-		return nil, fmt.Errorf("creating challenge provider: %w", err)
+		return nil, err
 	}
 
-	err = client.Challenge.SetDNS01Provider(provider)
+	return &Client{Client: client, user: acmeUser}, nil
+}
+
+// Environment variables letting a test harness point DNS-01 propagation
+// checks at a fake authoritative server (e.g. pebble-challtestsrv) instead
+// of the real DNS hierarchy. They're not meant to be set in production.
+const (
+	envDNS01Resolvers = "SCEP2ACME_DNS01_RESOLVERS"
+	envDNS01DisableCP = "SCEP2ACME_DNS01_DISABLE_CP"
+)
+
+// setupDNS01 registers the DNS-01 challenge provider on client: either a
+// single named provider, or - if dnsProvidersPath is set - a
+// DNSProviderRouter covering it and any per-suffix overrides. If
+// dnsSequentialInterval is nonzero, the provider is wrapped so lego solves
+// each domain's challenge one at a time, waiting dnsSequentialInterval
+// between each, instead of all of them concurrently - some DNS providers
+// rate-limit or serialize record updates and need this. skipPropagationCheck
+// disables lego's default wait for the challenge record to propagate before
+// telling the CA to validate.
+func setupDNS01(client *lego.Client, dnsProvider, dnsProvidersPath string, dnsSequentialInterval time.Duration, skipPropagationCheck bool) error {
+	opts := dns01Opts(skipPropagationCheck)
+
+	var provider challenge.Provider
+	if dnsProvidersPath == "" {
+		p, err := dns.NewDNSChallengeProviderByName(dnsProvider)
+		if err != nil {
+			return fmt.Errorf("creating challenge provider: %w", err)
+		}
+		provider = p
+	} else {
+		routerCfg, err := LoadDNSProviderRouterConfig(dnsProvidersPath)
+		if err != nil {
+			return fmt.Errorf("loading dns provider routes: %w", err)
+		}
+
+		router := NewDNSProviderRouter(routerCfg, dnsProvider)
+		opts = append(opts, dns01.WrapPreCheck(router.PreCheck))
+		provider = router
+	}
+
+	if dnsSequentialInterval > 0 {
+		provider = sequentialDNSProvider{Provider: provider, interval: dnsSequentialInterval}
+	}
+
+	if err := client.Challenge.SetDNS01Provider(provider, opts...); err != nil {
+		return fmt.Errorf("setting challenge provider: %w", err)
+	}
+
+	return nil
+}
+
+// sequentialDNSProvider wraps a challenge.Provider to make lego solve
+// DNS-01 challenges for multiple domains one at a time instead of
+// concurrently - lego's dns01 package checks for this via an unexported
+// "Sequential() time.Duration" interface rather than a ChallengeOption.
+type sequentialDNSProvider struct {
+	challenge.Provider
+	interval time.Duration
+}
+
+// Sequential reports the wait lego should insert between solving each
+// domain's DNS-01 challenge.
+func (p sequentialDNSProvider) Sequential() time.Duration {
+	return p.interval
+}
+
+// dns01Opts builds the dns01.ChallengeOptions driven by envDNS01Resolvers,
+// envDNS01DisableCP and skipPropagationCheck.
+func dns01Opts(skipPropagationCheck bool) []dns01.ChallengeOption {
+	var opts []dns01.ChallengeOption
+
+	if resolvers := os.Getenv(envDNS01Resolvers); resolvers != "" {
+		opts = append(opts, dns01.AddRecursiveNameservers(strings.Split(resolvers, ",")))
+	}
+	if os.Getenv(envDNS01DisableCP) != "" || skipPropagationCheck {
+		opts = append(opts, dns01.DisableCompletePropagationRequirement())
+	}
+
+	return opts
+}
+
+// loadOrRegisterAccount reuses a previously persisted registration when the
+// account file matches the configured email, ACME directory and account key,
+// validating it against the CA with QueryRegistration. Otherwise it performs
+// a fresh registration and persists the result.
+func loadOrRegisterAccount(client *lego.Client, acmeUser *UserInfo, accountPath, acmeURL string) (*registration.Resource, error) {
+	thumbprint, err := keyThumbprint(acmeUser.GetPrivateKey())
 	if err != nil {
-		return nil, fmt.Errorf("setting challenge provider: %w", err)
+		return nil, fmt.Errorf("computing account key thumbprint: %w", err)
+	}
+
+	rec, err := loadAccount(accountPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("loading acme account file: %w", err)
 	}
 
-	acmeUser.registration, err = client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	if rec != nil && rec.Email == acmeUser.email && rec.CADirURL == acmeURL && rec.KeyThumbprint == thumbprint {
+		acmeUser.registration = rec.Registration
+		if res, err := client.Registration.QueryRegistration(); err == nil {
+			return res, nil
+		}
+		// The CA no longer recognizes this account (e.g. it was deleted or
+		// the directory was reset) - fall through and register again.
+	}
+
+	res, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
 	if err != nil {
 		return nil, fmt.Errorf("registering acme account: %w", err)
 	}
 
-	return &Client{Client: client}, nil
+	if err := saveAccount(accountPath, &accountRecord{
+		Email:         acmeUser.email,
+		CADirURL:      acmeURL,
+		KeyThumbprint: thumbprint,
+		Registration:  res,
+	}); err != nil {
+		return nil, fmt.Errorf("persisting acme account: %w", err)
+	}
+
+	return res, nil
 }
 
 // CertificateSource returns a SCEP certificate source that uses ACME to obtain certificates
@@ -104,13 +265,13 @@ func (c *Client) CertificateSource() scepserver.CertificateSource {
 		}
 		res, err := c.Certificate.ObtainForCSR(request)
 		if err != nil {
-			return nil, fmt.Errorf("ObtainForCSR: %w", err)
+			return nil, fmt.Errorf("ObtainForCSR [request_id=%s]: %w", reqid.FromContext(ctx), err)
 		}
 
 		certBytes, _ := pem.Decode(res.Certificate)
 		crt, err := x509.ParseCertificate(certBytes.Bytes)
 		if err != nil {
-			return nil, fmt.Errorf("parsing obtained cert: %w", err)
+			return nil, fmt.Errorf("parsing obtained cert [request_id=%s]: %w", reqid.FromContext(ctx), err)
 		}
 
 		return crt, nil
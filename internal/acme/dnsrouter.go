@@ -0,0 +1,197 @@
+package acme
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	dnsprovider "github.com/go-acme/lego/v4/providers/dns"
+	rawdns "github.com/miekg/dns"
+	"gopkg.in/yaml.v2"
+)
+
+// DNSProviderRoute configures one entry of a --dnsproviders routing table:
+// FQDNs ending in Suffix are solved by Provider, with Env exported into the
+// process environment before that provider is constructed (most lego DNS
+// providers read their configuration from the environment). Nameservers, if
+// set, are queried directly when checking propagation for this zone instead
+// of the default recursive/authoritative lookup.
+type DNSProviderRoute struct {
+	Suffix      string            `yaml:"suffix"`
+	Provider    string            `yaml:"provider"`
+	Env         map[string]string `yaml:"env"`
+	Nameservers []string          `yaml:"nameservers"`
+}
+
+// DNSProviderRouterConfig is the top-level shape of the --dnsproviders YAML
+// file.
+type DNSProviderRouterConfig struct {
+	Routes []DNSProviderRoute `yaml:"routes"`
+}
+
+// LoadDNSProviderRouterConfig reads and parses a --dnsproviders YAML file.
+func LoadDNSProviderRouterConfig(path string) (*DNSProviderRouterConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+
+	var cfg DNSProviderRouterConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing file: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// DNSProviderRouter is a challenge.Provider that dispatches Present/CleanUp
+// to a different underlying provider depending on the FQDN being
+// challenged, matching the longest configured suffix and falling back to
+// fallbackProvider when nothing matches. Underlying providers are
+// constructed lazily, on first use, and cached for the life of the router.
+type DNSProviderRouter struct {
+	routes       []DNSProviderRoute // sorted longest-suffix-first
+	fallbackName string
+
+	mu        sync.Mutex
+	providers map[string]challenge.Provider // keyed by route suffix, "" for the fallback
+}
+
+// NewDNSProviderRouter creates a DNSProviderRouter that dispatches per
+// cfg.Routes, falling back to fallbackProviderName for any FQDN matching no
+// suffix.
+func NewDNSProviderRouter(cfg *DNSProviderRouterConfig, fallbackProviderName string) *DNSProviderRouter {
+	routes := append([]DNSProviderRoute{}, cfg.Routes...)
+	sort.Slice(routes, func(i, j int) bool {
+		return len(routes[i].Suffix) > len(routes[j].Suffix)
+	})
+
+	return &DNSProviderRouter{
+		routes:       routes,
+		fallbackName: fallbackProviderName,
+		providers:    map[string]challenge.Provider{},
+	}
+}
+
+// Present implements challenge.Provider.
+func (r *DNSProviderRouter) Present(domain, token, keyAuth string) error {
+	_, provider, err := r.providerFor(domain)
+	if err != nil {
+		return err
+	}
+	return provider.Present(domain, token, keyAuth)
+}
+
+// CleanUp implements challenge.Provider.
+func (r *DNSProviderRouter) CleanUp(domain, token, keyAuth string) error {
+	_, provider, err := r.providerFor(domain)
+	if err != nil {
+		return err
+	}
+	return provider.CleanUp(domain, token, keyAuth)
+}
+
+// route returns the route matching domain's longest configured suffix, or
+// nil if none match.
+func (r *DNSProviderRouter) route(domain string) *DNSProviderRoute {
+	fqdn := strings.TrimSuffix(domain, ".")
+	for i := range r.routes {
+		route := &r.routes[i]
+		if fqdn == route.Suffix || strings.HasSuffix(fqdn, "."+route.Suffix) {
+			return route
+		}
+	}
+	return nil
+}
+
+// providerFor returns the (possibly lazily constructed) provider for domain,
+// along with the route it matched (nil when the fallback provider is used).
+func (r *DNSProviderRouter) providerFor(domain string) (*DNSProviderRoute, challenge.Provider, error) {
+	route := r.route(domain)
+
+	key := ""
+	providerName := r.fallbackName
+	if route != nil {
+		key = route.Suffix
+		providerName = route.Provider
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.providers[key]; ok {
+		return route, p, nil
+	}
+
+	if route != nil {
+		for k, v := range route.Env {
+			if err := os.Setenv(k, v); err != nil {
+				return nil, nil, fmt.Errorf("setting %s for suffix %q: %w", k, route.Suffix, err)
+			}
+		}
+	}
+
+	p, err := dnsprovider.NewDNSChallengeProviderByName(providerName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("constructing dns provider %q: %w", providerName, err)
+	}
+
+	r.providers[key] = p
+	return route, p, nil
+}
+
+// PreCheck implements dns01.WrapPreCheckFunc. When domain's matched route
+// configures explicit Nameservers, those are queried directly for the
+// challenge TXT record instead of running the default recursive and
+// authoritative nameserver discovery.
+func (r *DNSProviderRouter) PreCheck(domain, fqdn, value string, check dns01.PreCheckFunc) (bool, error) {
+	route := r.route(domain)
+	if route == nil || len(route.Nameservers) == 0 {
+		return check(fqdn, value)
+	}
+
+	return checkTXTRecord(fqdn, value, route.Nameservers)
+}
+
+// checkTXTRecord queries each of nameservers directly for fqdn's TXT record
+// and confirms it matches value.
+func checkTXTRecord(fqdn, value string, nameservers []string) (bool, error) {
+	client := new(rawdns.Client)
+
+	msg := new(rawdns.Msg)
+	msg.SetQuestion(fqdn, rawdns.TypeTXT)
+	msg.RecursionDesired = false
+
+	for _, ns := range nameservers {
+		addr := ns
+		if _, _, err := net.SplitHostPort(ns); err != nil {
+			addr = net.JoinHostPort(ns, "53")
+		}
+
+		resp, _, err := client.Exchange(msg, addr)
+		if err != nil {
+			return false, fmt.Errorf("querying %s for %s: %w", ns, fqdn, err)
+		}
+		if resp.Rcode != rawdns.RcodeSuccess {
+			return false, fmt.Errorf("%s returned %s for %s", ns, rawdns.RcodeToString[resp.Rcode], fqdn)
+		}
+
+		var found bool
+		for _, rr := range resp.Answer {
+			if txt, ok := rr.(*rawdns.TXT); ok && strings.Join(txt.Txt, "") == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, fmt.Errorf("%s did not return the expected TXT record for %s", ns, fqdn)
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,72 @@
+package acme
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"go.bog.dev/scep2acme/internal/whitelist"
+)
+
+// ProfileConfig holds everything NewClient needs to build a *Client for one
+// named ACME profile - the same settings available as top-level -acme*
+// flags, so a single scep2acme instance can front more than one ACME
+// directory/account (e.g. an internal CA for corp hostnames alongside
+// Let's Encrypt for public ones), routed per request by the whitelist.
+type ProfileConfig struct {
+	ACMEEmail             string        `yaml:"acmeemail"`
+	ACMEKeyPath           string        `yaml:"acmekey"`
+	ACMEAccountPath       string        `yaml:"acmeaccount"`
+	ACMEURL               string        `yaml:"acmeurl"`
+	Challenge             string        `yaml:"challenge"`
+	DNSProvider           string        `yaml:"dnsprovider"`
+	DNSProvidersPath      string        `yaml:"dnsproviders"`
+	HTTPChallengePort     string        `yaml:"httpport"`
+	TLSALPNChallengePort  string        `yaml:"tlsalpnport"`
+	DNSSequentialInterval time.Duration `yaml:"dnssequential"`
+	SkipPropagationCheck  bool          `yaml:"skippropagationcheck"`
+}
+
+// ProfilesConfig is the top-level shape of a -profiles YAML file: ACME
+// profile name to its settings. A profile named whitelist.DefaultProfile
+// overrides the client built from the top-level -acme* flags entirely.
+type ProfilesConfig map[string]ProfileConfig
+
+// LoadProfilesConfig reads and parses a -profiles YAML file.
+func LoadProfilesConfig(path string) (ProfilesConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+
+	var cfg ProfilesConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing file: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// NewClients builds a *Client for defaultProfile - typically assembled from
+// the top-level -acme* flags - plus one for every entry in profiles, keyed
+// by name. An entry in profiles named whitelist.DefaultProfile takes
+// precedence over defaultProfile.
+func NewClients(defaultProfile ProfileConfig, profiles ProfilesConfig) (map[string]*Client, error) {
+	all := ProfilesConfig{whitelist.DefaultProfile: defaultProfile}
+	for name, p := range profiles {
+		all[name] = p
+	}
+
+	clients := make(map[string]*Client, len(all))
+	for name, p := range all {
+		client, err := NewClient(p.ACMEEmail, p.ACMEKeyPath, p.ACMEAccountPath, p.ACMEURL, p.Challenge, p.DNSProvider, p.DNSProvidersPath, p.HTTPChallengePort, p.TLSALPNChallengePort, p.DNSSequentialInterval, p.SkipPropagationCheck)
+		if err != nil {
+			return nil, fmt.Errorf("building acme client for profile %q: %w", name, err)
+		}
+		clients[name] = client
+	}
+
+	return clients, nil
+}
@@ -0,0 +1,103 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	legoacme "github.com/go-acme/lego/v4/acme"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/platform/tester"
+	"github.com/go-acme/lego/v4/platform/tester/servermock"
+	"github.com/go-acme/lego/v4/registration"
+	"github.com/smallstep/scep"
+	"github.com/stretchr/testify/require"
+
+	"go.bog.dev/scep2acme/internal/reqid"
+	"go.bog.dev/scep2acme/internal/store"
+)
+
+// This is a deterministic unit test for the urn:ietf:params:acme:error:rateLimited
+// failure path. Pebble (used by internal/e2etest) doesn't trivially simulate
+// ACME rate limiting, so it's covered here instead, against a minimal fake
+// ACME directory built with lego's own test helpers.
+func TestStoredSource_ObtainCertificate_RateLimited(t *testing.T) {
+	server := tester.MockACMEServer().
+		Route("/account", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Location", fmt.Sprintf("https://%s/account", req.Context().Value(http.LocalAddrContextKey)))
+			servermock.JSONEncode(legoacme.Account{Status: "valid"}).ServeHTTP(rw, req)
+		})).
+		Route("/newOrder", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			servermock.JSONEncode(legoacme.ProblemDetails{
+				Type:   legoacme.RateLimitedErr,
+				Detail: "too many certificates already issued for this exact set of identifiers",
+			}).WithStatusCode(http.StatusTooManyRequests).ServeHTTP(rw, req)
+		})).
+		BuildHTTPS(t)
+
+	user := newTestUserInfo(t)
+
+	legoConfig := lego.NewConfig(user)
+	legoConfig.CADirURL = server.URL + "/dir"
+	legoConfig.HTTPClient = server.Client()
+
+	legoClient, err := lego.NewClient(legoConfig)
+	require.NoError(t, err)
+
+	reg, err := legoClient.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	require.NoError(t, err)
+	user.registration = reg
+
+	client := &Client{Client: legoClient, user: user}
+	src := client.NewStoredSource(store.NewMemoryStore())
+
+	ctx := reqid.WithValue(context.Background(), "test-request-id")
+	_, err = src.ObtainCertificate(ctx, &scep.PKIMessage{CSRReqMessage: &scep.CSRReqMessage{CSR: testCSR(t)}})
+	require.Error(t, err)
+	require.ErrorContains(t, err, legoacme.RateLimitedErr)
+	require.ErrorContains(t, err, "test-request-id")
+}
+
+// newTestUserInfo returns a UserInfo backed by a freshly generated account
+// key written to a temp file, as NewClient would produce from -acmekey.
+func newTestUserInfo(t *testing.T) *UserInfo {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keyPath := filepath.Join(t.TempDir(), "account.key")
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), 0o600)
+	require.NoError(t, err)
+
+	return NewUserInfo("test@example.com", keyPath)
+}
+
+// testCSR returns a minimal, validly-signed CSR for use as PKIMessage.CSR.
+func testCSR(t *testing.T) *x509.CertificateRequest {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "ratelimited.example.com"},
+	}, key)
+	require.NoError(t, err)
+
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+
+	return csr
+}
@@ -0,0 +1,261 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/registration"
+	"github.com/go-kit/kit/log"
+	"github.com/smallstep/scep"
+	"github.com/smallstep/scep/x509util"
+	scepserver "go.bog.dev/scep2acme/internal/scepserver"
+	"golang.org/x/sync/singleflight"
+
+	"go.bog.dev/scep2acme/internal/idn"
+	"go.bog.dev/scep2acme/internal/reqid"
+	"go.bog.dev/scep2acme/internal/store"
+	"go.bog.dev/scep2acme/internal/whitelist"
+)
+
+// ProfileResolver resolves the ACME profile a CSR presenting password and
+// names (its CommonName plus its SANs) should be routed to. It's satisfied
+// by *whitelist.CSRPasswordVerifier.
+type ProfileResolver interface {
+	Profile(password string, names []string) (profile string, ok bool)
+}
+
+// NewStoredSource returns a SCEP certificate source that always issues
+// through c, consulting st before calling ObtainForCSR so repeated requests
+// for hostnames it already holds a valid certificate for - including
+// retries of an identical CSR, common while challenge validation is still
+// pending - are served from the store. Every newly issued certificate is
+// persisted back to st, keyed by its hostnames, so a Renewer can later
+// refresh it in the background.
+func (c *Client) NewStoredSource(st store.Store) scepserver.CertificateSource {
+	return &storedSource{
+		clientFor: func(*scep.PKIMessage) (*Client, string, error) {
+			return c, whitelist.DefaultProfile, nil
+		},
+		store: st,
+	}
+}
+
+// NewRoutedStoredSource is like NewStoredSource, but picks which of clients
+// to issue through per request: resolver is consulted with the CSR's
+// challenge password and hostnames, as configured per-entry in the
+// whitelist, falling back to whitelist.DefaultProfile when resolver has no
+// opinion. This is how one scep2acme instance fronts multiple ACME
+// profiles - e.g. an internal CA for corp hostnames and Let's Encrypt for
+// public ones.
+func NewRoutedStoredSource(clients map[string]*Client, resolver ProfileResolver, st store.Store) scepserver.CertificateSource {
+	return &storedSource{
+		clientFor: func(msg *scep.PKIMessage) (*Client, string, error) {
+			profile := whitelist.DefaultProfile
+
+			if password, err := x509util.ParseChallengePassword(msg.CSR.Raw); err == nil {
+				if p, ok := resolver.Profile(password, certcrypto.ExtractDomainsCSR(msg.CSR)); ok {
+					profile = p
+				}
+			}
+
+			client, ok := clients[profile]
+			if !ok {
+				return nil, "", fmt.Errorf("no acme client configured for profile %q", profile)
+			}
+			return client, profile, nil
+		},
+		store: st,
+	}
+}
+
+type storedSource struct {
+	clientFor func(msg *scep.PKIMessage) (client *Client, profile string, err error)
+	store     store.Store
+	group     singleflight.Group
+}
+
+// ObtainCertificate implements scepserver.CertificateSource.
+func (s *storedSource) ObtainCertificate(ctx context.Context, msg *scep.PKIMessage) (*x509.Certificate, error) {
+	// Normalized to ASCII/punycode so an internationalized hostname keys the
+	// store, and is looked up by the whitelist's ProfileResolver, the same
+	// way regardless of which form the SCEP client's CSR used.
+	domains := idn.ToASCIISlice(certcrypto.ExtractDomainsCSR(msg.CSR))
+	key := store.Key(domains)
+
+	client, profile, err := s.clientFor(msg)
+	if err != nil {
+		return nil, fmt.Errorf("selecting acme client [request_id=%s]: %w", reqid.FromContext(ctx), err)
+	}
+
+	// rec.Profile must match the profile this request would route to now,
+	// not just at whichever earlier request issued it - otherwise a
+	// whitelist reload that re-points a hostname at a different profile
+	// (e.g. moving it from a public CA to an internal one) would keep
+	// serving the old profile's cached cert for up to 2/3 of its remaining
+	// lifetime. Records persisted before profile routing existed have an
+	// empty Profile, which is DefaultProfile (see NewRenewer).
+	if rec, ok, err := s.store.Get(key); err == nil && ok && rec.Valid(domains) {
+		recProfile := rec.Profile
+		if recProfile == "" {
+			recProfile = whitelist.DefaultProfile
+		}
+		if recProfile == profile {
+			if crt, err := parseLeafPEM(rec.Certificate); err == nil {
+				return crt, nil
+			}
+		}
+	}
+
+	crtAny, err, _ := s.group.Do(key, func() (interface{}, error) {
+		res, err := client.Certificate.ObtainForCSR(certificate.ObtainForCSRRequest{CSR: msg.CSR})
+		if err != nil {
+			return nil, fmt.Errorf("ObtainForCSR [request_id=%s]: %w", reqid.FromContext(ctx), err)
+		}
+
+		if err := s.store.Put(key, recordFromResource(res, domains, client.GetRegistration(), profile)); err != nil {
+			return nil, fmt.Errorf("storing issued certificate: %w", err)
+		}
+
+		crt, err := parseLeafPEM(res.Certificate)
+		if err != nil {
+			return nil, fmt.Errorf("parsing obtained cert [request_id=%s]: %w", reqid.FromContext(ctx), err)
+		}
+
+		return crt, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return crtAny.(*x509.Certificate), nil
+}
+
+// Renewer periodically scans a store for records nearing expiry and renews
+// them via ACME, so SCEP clients are served an already-fresh certificate
+// instead of triggering a renewal inline.
+type Renewer struct {
+	clients map[string]*Client
+	store   store.Store
+	logger  log.Logger
+}
+
+// NewRenewer creates a Renewer that renews records in st using whichever of
+// clients issued them (see Record.Profile), falling back to
+// whitelist.DefaultProfile for records persisted before profile routing
+// existed.
+func NewRenewer(clients map[string]*Client, st store.Store, logger log.Logger) *Renewer {
+	return &Renewer{clients: clients, store: st, logger: logger}
+}
+
+// Run scans the store every interval, renewing any record that no longer
+// satisfies Record.Valid, until ctx is done.
+func (r *Renewer) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.scan()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (r *Renewer) scan() {
+	keys, err := r.store.Keys()
+	if err != nil {
+		r.logger.Log("msg", "listing store entries", "err", err)
+		return
+	}
+
+	for _, key := range keys {
+		rec, ok, err := r.store.Get(key)
+		if err != nil {
+			r.logger.Log("msg", "reading store entry", "key", key, "err", err)
+			continue
+		}
+		if !ok || rec.Valid(rec.SANs) || len(rec.CSR) == 0 {
+			continue
+		}
+
+		profile := rec.Profile
+		if profile == "" {
+			profile = whitelist.DefaultProfile
+		}
+		client, ok := r.clients[profile]
+		if !ok {
+			r.logger.Log("msg", "renewing certificate", "key", key, "domain", rec.Domain, "err", fmt.Sprintf("no acme client configured for profile %q", profile))
+			continue
+		}
+
+		res, err := client.Certificate.Renew(certificate.Resource{
+			Domain:            rec.Domain,
+			CertURL:           rec.CertURL,
+			CertStableURL:     rec.CertStableURL,
+			PrivateKey:        rec.PrivateKey,
+			Certificate:       rec.Certificate,
+			IssuerCertificate: rec.IssuerCertificate,
+			CSR:               rec.CSR,
+		}, false, false, "")
+		if err != nil {
+			r.logger.Log("msg", "renewing certificate", "key", key, "domain", rec.Domain, "err", err)
+			continue
+		}
+
+		if err := r.store.Put(key, recordFromResource(res, rec.SANs, client.GetRegistration(), profile)); err != nil {
+			r.logger.Log("msg", "storing renewed certificate", "key", key, "domain", rec.Domain, "err", err)
+			continue
+		}
+
+		r.logger.Log("msg", "renewed certificate", "domain", rec.Domain)
+	}
+}
+
+// parseLeafPEM parses the leaf certificate out of a PEM-encoded
+// certificate.Resource.Certificate, which may be a bundle with the issuer
+// chain appended.
+func parseLeafPEM(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("decoding PEM certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// recordFromResource builds a store.Record from a freshly obtained or
+// renewed certificate.Resource, tagged with the ACME profile it was issued
+// through so a later Renewer run uses the same client.
+func recordFromResource(res *certificate.Resource, sans []string, reg *registration.Resource, profile string) *store.Record {
+	crt, err := parseLeafPEM(res.Certificate)
+	issuedAt, expiresAt := time.Now(), time.Time{}
+	if err == nil {
+		issuedAt, expiresAt = crt.NotBefore, crt.NotAfter
+	}
+
+	accountURL := ""
+	if reg != nil {
+		accountURL = reg.URI
+	}
+
+	return &store.Record{
+		Domain:            res.Domain,
+		SANs:              sans,
+		CertURL:           res.CertURL,
+		CertStableURL:     res.CertStableURL,
+		AccountURL:        accountURL,
+		Profile:           profile,
+		Certificate:       res.Certificate,
+		IssuerCertificate: res.IssuerCertificate,
+		PrivateKey:        res.PrivateKey,
+		CSR:               res.CSR,
+		IssuedAt:          issuedAt,
+		ExpiresAt:         expiresAt,
+	}
+}
@@ -0,0 +1,164 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	legoacme "github.com/go-acme/lego/v4/acme"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/platform/tester"
+	"github.com/go-acme/lego/v4/platform/tester/servermock"
+	"github.com/go-acme/lego/v4/registration"
+	"github.com/smallstep/scep"
+	"github.com/stretchr/testify/require"
+
+	"go.bog.dev/scep2acme/internal/reqid"
+	"go.bog.dev/scep2acme/internal/store"
+)
+
+// selfSignedCertPEM mints a minimal, validly-dated self-signed certificate
+// for domain, PEM-encoded exactly as store.Record.Certificate holds it.
+func selfSignedCertPEM(t *testing.T, domain string) []byte {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(100 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// csrForDomain returns a minimal, validly-signed CSR naming domain as its
+// CommonName, for use as PKIMessage.CSR.
+func csrForDomain(t *testing.T, domain string) *x509.CertificateRequest {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: domain},
+	}, key)
+	require.NoError(t, err)
+
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+
+	return csr
+}
+
+// rateLimitingClient returns a *Client whose Certificate.ObtainForCSR always
+// fails fast with a rateLimited ACME problem, so a test can tell a reissue
+// was attempted (the call errors) without a real CA round trip.
+func rateLimitingClient(t *testing.T) *Client {
+	t.Helper()
+
+	server := tester.MockACMEServer().
+		Route("/account", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Location", fmt.Sprintf("https://%s/account", req.Context().Value(http.LocalAddrContextKey)))
+			servermock.JSONEncode(legoacme.Account{Status: "valid"}).ServeHTTP(rw, req)
+		})).
+		Route("/newOrder", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			servermock.JSONEncode(legoacme.ProblemDetails{
+				Type:   legoacme.RateLimitedErr,
+				Detail: "too many certificates already issued for this exact set of identifiers",
+			}).WithStatusCode(http.StatusTooManyRequests).ServeHTTP(rw, req)
+		})).
+		BuildHTTPS(t)
+
+	user := newTestUserInfo(t)
+
+	legoConfig := lego.NewConfig(user)
+	legoConfig.CADirURL = server.URL + "/dir"
+	legoConfig.HTTPClient = server.Client()
+
+	legoClient, err := lego.NewClient(legoConfig)
+	require.NoError(t, err)
+
+	reg, err := legoClient.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	require.NoError(t, err)
+	user.registration = reg
+
+	return &Client{Client: legoClient, user: user}
+}
+
+// putRecord stores a valid cached Record for domain under profile, as if a
+// prior request had already issued through it.
+func putRecord(t *testing.T, st store.Store, domain, profile string) {
+	t.Helper()
+
+	key := store.Key([]string{domain})
+	err := st.Put(key, &store.Record{
+		Domain:      domain,
+		SANs:        []string{domain},
+		Profile:     profile,
+		Certificate: selfSignedCertPEM(t, domain),
+		IssuedAt:    time.Now().Add(-time.Hour),
+		ExpiresAt:   time.Now().Add(100 * time.Hour),
+	})
+	require.NoError(t, err)
+}
+
+// TestStoredSource_ObtainCertificate_SameProfileServesCache verifies that a
+// cache hit for the profile the request would route to now is served
+// straight from the store, without ever touching the ACME client - a nil
+// embedded *lego.Client would panic if it were.
+func TestStoredSource_ObtainCertificate_SameProfileServesCache(t *testing.T) {
+	const domain = "cached.example.com"
+	st := store.NewMemoryStore()
+	putRecord(t, st, domain, "prof-a")
+
+	src := &storedSource{
+		clientFor: func(*scep.PKIMessage) (*Client, string, error) {
+			return &Client{}, "prof-a", nil
+		},
+		store: st,
+	}
+
+	ctx := reqid.WithValue(context.Background(), "test-request-id")
+	crt, err := src.ObtainCertificate(ctx, &scep.PKIMessage{CSRReqMessage: &scep.CSRReqMessage{CSR: csrForDomain(t, domain)}})
+	require.NoError(t, err)
+	require.Equal(t, domain, crt.Subject.CommonName)
+}
+
+// TestStoredSource_ObtainCertificate_ProfileChangeBypassesCache verifies
+// that a cached record issued under one profile is not served once the
+// whitelist routes the hostname to a different profile - the request must
+// fall through to reissuing (and here fail, since rateLimitingClient always
+// errors), rather than silently keep serving the stale profile's cert.
+func TestStoredSource_ObtainCertificate_ProfileChangeBypassesCache(t *testing.T) {
+	const domain = "cached.example.com"
+	st := store.NewMemoryStore()
+	putRecord(t, st, domain, "prof-a")
+
+	client := rateLimitingClient(t)
+	src := &storedSource{
+		clientFor: func(*scep.PKIMessage) (*Client, string, error) {
+			return client, "prof-b", nil
+		},
+		store: st,
+	}
+
+	ctx := reqid.WithValue(context.Background(), "test-request-id")
+	_, err := src.ObtainCertificate(ctx, &scep.PKIMessage{CSRReqMessage: &scep.CSRReqMessage{CSR: csrForDomain(t, domain)}})
+	require.Error(t, err)
+	require.ErrorContains(t, err, legoacme.RateLimitedErr)
+}
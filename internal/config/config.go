@@ -4,62 +4,121 @@ import (
 	"flag"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/go-acme/lego/v4/lego"
 )
 
 // Config holds all configuration for the scep2acme application
 type Config struct {
-	ListenPort    string
-	CertPath      string
-	CertKeyPath   string
-	ACMEKeyPath   string
-	ACMEEmail     string
-	ACMEURL       string
-	WhitelistPath string
-	DNSProvider   string
-	Debug         bool
+	ListenPort            string
+	CertPath              string
+	CertKeyPath           string
+	RAPKCS12Path          string
+	RAKeyPassphraseFile   string
+	ACMEKeyPath           string
+	ACMEAccountPath       string
+	ACMEEmail             string
+	ACMEURL               string
+	WhitelistPath         string
+	AuditLogPath          string
+	ProfilesPath          string
+	Challenge             string
+	DNSProvider           string
+	DNSProvidersPath      string
+	HTTPChallengePort     string
+	TLSALPNChallengePort  string
+	StorePath             string
+	RenewInterval         time.Duration
+	DNSSequentialInterval time.Duration
+	SkipPropagationCheck  bool
+	Debug                 bool
 }
 
 // ParseFlags parses command line flags and returns a Config
 func ParseFlags() *Config {
 	var (
-		listenPort    = flag.String("listen", "127.0.0.1:8383", "Listen IP and port")
-		certPath      = flag.String("cert", "", "Path to certificate file - should include 2 certificates (RA & CA). RA certificate should be signed by CA.")
-		certKeyPath   = flag.String("certkey", "", "Path to certificate key")
-		acmeKeyPath   = flag.String("acmekey", "", "Path to ACME account key")
-		acmeEmail     = flag.String("acmeemail", "", "ACME account email address - Terms of Service will be accepted automatically")
-		acmeURL       = flag.String("acmeurl", lego.LEDirectoryStaging, fmt.Sprintf("ACME directory URL (default is the Let's Encrypt staging directory, to switch to production directory use \"%v\")", lego.LEDirectoryProduction))
-		whitelistPath = flag.String("whitelist", "", "Path to hostname whitelist configuration")
-		dnsProvider   = flag.String("dnsprovider", "", "DNS provider used for DNS-01 challenges - environment variables should be used for configuration, docs at https://go-acme.github.io/lego/dns/")
-		debug         = flag.Bool("debug", false, "Enable debug logging")
+		listenPort          = flag.String("listen", "127.0.0.1:8383", "Listen IP and port")
+		certPath            = flag.String("cert", "", "Path to certificate file - should include 2 certificates (RA & CA). RA certificate should be signed by CA. Ignored if -ra-pkcs12 is set, or if this path ends in .p12/.pfx, in which case it's read as a PKCS#12 bundle instead.")
+		certKeyPath         = flag.String("certkey", "", "RA key, as a path/file:// URI, or a pkcs11:// or tpm:// URI for a hardware-backed key. Ignored if -cert resolves to a PKCS#12 bundle.")
+		raPKCS12Path        = flag.String("ra-pkcs12", "", "Path to a PKCS#12 bundle containing the RA key, RA certificate and CA chain together, instead of -cert/-certkey")
+		raKeyPassphraseFile = flag.String("ra-key-passphrase-file", "", "Path to a file holding the passphrase decrypting an encrypted -certkey or -ra-pkcs12 (falls back to the SCEP2ACME_RA_KEY_PASSPHRASE environment variable)")
+		acmeKeyPath         = flag.String("acmekey", "", "Path to ACME account key")
+		acmeAccountPath     = flag.String("acmeaccount", "", "Path to ACME account registration file (default: <acmekey>.account.json)")
+		acmeEmail           = flag.String("acmeemail", "", "ACME account email address - Terms of Service will be accepted automatically")
+		acmeURL             = flag.String("acmeurl", lego.LEDirectoryStaging, fmt.Sprintf("ACME directory URL (default is the Let's Encrypt staging directory, to switch to production directory use \"%v\")", lego.LEDirectoryProduction))
+		whitelistPath       = flag.String("whitelist", "", "Path to hostname whitelist configuration")
+		auditLogPath        = flag.String("auditlog", "", "Path to a JSON-lines audit log recording every CSR whitelist decision (disabled if empty)")
+		profilesPath        = flag.String("profiles", "", "Path to a YAML file defining additional named ACME profiles (own directory URL, account key, email, DNS provider), selected per-hostname in the whitelist")
+		challenge           = flag.String("challenge", ChallengeDNS01, fmt.Sprintf("ACME challenge type to solve: %q, %q or %q", ChallengeDNS01, ChallengeHTTP01, ChallengeTLSALPN01))
+		dnsProvider         = flag.String("dnsprovider", "", "DNS provider used for DNS-01 challenges - environment variables should be used for configuration, docs at https://go-acme.github.io/lego/dns/")
+		dnsProvidersPath    = flag.String("dnsproviders", "", "Path to a YAML file routing DNS-01 challenges to different providers by hostname suffix (falls back to -dnsprovider for unmatched names)")
+		httpPort            = flag.String("httpport", "80", "Port the HTTP-01 challenge responder listens on")
+		tlsALPNPort         = flag.String("tlsalpnport", "443", "Port the TLS-ALPN-01 challenge responder listens on")
+		storePath           = flag.String("store", "", "Directory used to persist issued certificates across restarts (disabled if empty, falls back to an in-memory store)")
+		renewInterval       = flag.Duration("renewinterval", time.Hour, "How often the background renewal loop scans the certificate store for entries nearing expiry")
+		dnsSequential       = flag.Duration("dnssequential", 0, "If set, solve DNS-01 challenges for multiple domains one at a time, waiting this long between each - works around DNS providers that rate-limit or serialize record updates")
+		skipPropagation     = flag.Bool("skippropagationcheck", false, "Skip waiting for DNS-01 challenge records to propagate before telling the CA to validate - only safe against CAs/providers known to retry validation themselves")
+		debug               = flag.Bool("debug", false, "Enable debug logging")
 	)
 
 	flag.Parse()
 
 	cfg := &Config{
-		ListenPort:    *listenPort,
-		CertPath:      *certPath,
-		CertKeyPath:   *certKeyPath,
-		ACMEKeyPath:   *acmeKeyPath,
-		ACMEEmail:     *acmeEmail,
-		ACMEURL:       *acmeURL,
-		WhitelistPath: *whitelistPath,
-		DNSProvider:   *dnsProvider,
-		Debug:         *debug,
+		ListenPort:            *listenPort,
+		CertPath:              *certPath,
+		CertKeyPath:           *certKeyPath,
+		RAPKCS12Path:          *raPKCS12Path,
+		RAKeyPassphraseFile:   *raKeyPassphraseFile,
+		ACMEKeyPath:           *acmeKeyPath,
+		ACMEAccountPath:       *acmeAccountPath,
+		ACMEEmail:             *acmeEmail,
+		ACMEURL:               *acmeURL,
+		WhitelistPath:         *whitelistPath,
+		AuditLogPath:          *auditLogPath,
+		ProfilesPath:          *profilesPath,
+		Challenge:             *challenge,
+		DNSProvider:           *dnsProvider,
+		DNSProvidersPath:      *dnsProvidersPath,
+		HTTPChallengePort:     *httpPort,
+		TLSALPNChallengePort:  *tlsALPNPort,
+		StorePath:             *storePath,
+		RenewInterval:         *renewInterval,
+		DNSSequentialInterval: *dnsSequential,
+		SkipPropagationCheck:  *skipPropagation,
+		Debug:                 *debug,
 	}
 
 	return cfg
 }
 
+// Supported values for -challenge.
+const (
+	ChallengeDNS01     = "dns-01"
+	ChallengeHTTP01    = "http-01"
+	ChallengeTLSALPN01 = "tls-alpn-01"
+)
+
 // Validate validates the configuration and panics if any mandatory fields are missing
 func (c *Config) Validate() {
-	c.mandatoryFlag("cert", c.CertPath)
-	c.mandatoryFlag("certkey", c.CertKeyPath)
+	if c.RAPKCS12Path == "" {
+		c.mandatoryFlag("cert", c.CertPath)
+		c.mandatoryFlag("certkey", c.CertKeyPath)
+	}
 	c.mandatoryFlag("acmeemail", c.ACMEEmail)
 	c.mandatoryFlag("acmekey", c.ACMEKeyPath)
-	c.mandatoryFlag("dnsprovider", c.DNSProvider)
 	c.mandatoryFlag("whitelist", c.WhitelistPath)
+
+	switch c.Challenge {
+	case ChallengeDNS01:
+		c.mandatoryFlag("dnsprovider", c.DNSProvider)
+	case ChallengeHTTP01:
+		c.mandatoryFlag("httpport", c.HTTPChallengePort)
+	case ChallengeTLSALPN01:
+		c.mandatoryFlag("tlsalpnport", c.TLSALPNChallengePort)
+	default:
+		panic(fmt.Sprintf("-challenge must be one of %q, %q or %q, got %q", ChallengeDNS01, ChallengeHTTP01, ChallengeTLSALPN01, c.Challenge))
+	}
 }
 
 func (c *Config) mandatoryFlag(name string, value interface{}) {
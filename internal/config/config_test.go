@@ -0,0 +1,101 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// minimalValidConfig returns a Config that satisfies Validate - tests mutate
+// a copy to drop exactly the field under test.
+func minimalValidConfig() *Config {
+	return &Config{
+		CertPath:      "ra.pem",
+		CertKeyPath:   "ra.key",
+		ACMEEmail:     "acme@example.com",
+		ACMEKeyPath:   "acme.key",
+		WhitelistPath: "whitelist.yaml",
+		Challenge:     ChallengeDNS01,
+		DNSProvider:   "route53",
+	}
+}
+
+func TestValidatePanicsOnMissingMandatoryFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Config)
+	}{
+		{"cert missing", func(c *Config) { c.CertPath = "" }},
+		{"certkey missing", func(c *Config) { c.CertKeyPath = "" }},
+		{"acmeemail missing", func(c *Config) { c.ACMEEmail = "" }},
+		{"acmekey missing", func(c *Config) { c.ACMEKeyPath = "" }},
+		{"whitelist missing", func(c *Config) { c.WhitelistPath = "" }},
+		{"dnsprovider missing for dns-01", func(c *Config) { c.DNSProvider = "" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := minimalValidConfig()
+			tt.mutate(cfg)
+			require.Panics(t, cfg.Validate)
+		})
+	}
+}
+
+func TestValidatePassesWithAllMandatoryFlagsSet(t *testing.T) {
+	require.NotPanics(t, minimalValidConfig().Validate)
+}
+
+func TestValidateRAPKCS12PathSkipsCertAndCertKey(t *testing.T) {
+	cfg := minimalValidConfig()
+	cfg.CertPath = ""
+	cfg.CertKeyPath = ""
+	cfg.RAPKCS12Path = "ra.p12"
+
+	require.NotPanics(t, cfg.Validate)
+}
+
+func TestValidateChallengeSpecificFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Config)
+		panics bool
+	}{
+		{"http-01 requires httpport", func(c *Config) {
+			c.Challenge = ChallengeHTTP01
+			c.DNSProvider = ""
+			c.HTTPChallengePort = ""
+		}, true},
+		{"http-01 with httpport set", func(c *Config) {
+			c.Challenge = ChallengeHTTP01
+			c.DNSProvider = ""
+			c.HTTPChallengePort = "80"
+		}, false},
+		{"tls-alpn-01 requires tlsalpnport", func(c *Config) {
+			c.Challenge = ChallengeTLSALPN01
+			c.DNSProvider = ""
+			c.TLSALPNChallengePort = ""
+		}, true},
+		{"tls-alpn-01 with tlsalpnport set", func(c *Config) {
+			c.Challenge = ChallengeTLSALPN01
+			c.DNSProvider = ""
+			c.TLSALPNChallengePort = "443"
+		}, false},
+		{"unknown challenge type", func(c *Config) {
+			c.Challenge = "made-up-01"
+			c.DNSProvider = ""
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := minimalValidConfig()
+			tt.mutate(cfg)
+			if tt.panics {
+				require.Panics(t, cfg.Validate)
+			} else {
+				require.NotPanics(t, cfg.Validate)
+			}
+		})
+	}
+}
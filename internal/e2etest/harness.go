@@ -0,0 +1,239 @@
+// Package e2etest boots a local Pebble ACME server and pebble-challtestsrv
+// (both from letsencrypt/pebble) as subprocesses, so tests can drive a real
+// ACME order - including DNS-01 validation - without reaching Let's
+// Encrypt's staging environment. It mirrors the harness lego uses for its
+// own e2e suite (e2e/loader in github.com/go-acme/lego/v4).
+//
+// Tests built around Harness are gated behind the SCEP2ACME_E2E_TESTS
+// environment variable and the presence of the "pebble" and
+// "pebble-challtestsrv" binaries on PATH; New skips the calling test rather
+// than failing when either precondition isn't met.
+package e2etest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// EnvEnable is the environment variable that must be set (to any non-empty
+// value) to run tests built around Harness. Like the binaries it boots,
+// it's expected to be present in CI but not on contributors' machines.
+const EnvEnable = "SCEP2ACME_E2E_TESTS"
+
+const (
+	pebbleCmd   = "pebble"
+	challSrvCmd = "pebble-challtestsrv"
+
+	// DirectoryURL is Pebble's ACME directory endpoint.
+	DirectoryURL = "https://localhost:14000/dir"
+
+	challSrvMgmtAddr = "localhost:8055"
+	dns01ListenAddr  = ":8053"
+
+	// DNS01Resolver is the nameserver both Pebble and lego's DNS-01
+	// validation must be pointed at so TXT records published through
+	// SetTXT are actually visible - pebble-challtestsrv, not real DNS.
+	DNS01Resolver = "localhost:8053"
+)
+
+// Harness manages a Pebble + pebble-challtestsrv pair for the lifetime of a
+// test.
+type Harness struct {
+	t          testing.TB
+	pebble     *exec.Cmd
+	challSrv   *exec.Cmd
+	pebbleOut  *bytes.Buffer
+	challOut   *bytes.Buffer
+	caCertPath string
+	httpClient *http.Client
+}
+
+// New boots pebble-challtestsrv and Pebble (configured to resolve all DNS
+// through it, via -dnsserver) and waits for Pebble's directory endpoint to
+// come up. It calls t.Skip, rather than t.Fatal, if EnvEnable isn't set or
+// either binary isn't on PATH, so the e2e suite is a no-op for contributors
+// who haven't installed Pebble locally.
+func New(t *testing.T) *Harness {
+	t.Helper()
+
+	if os.Getenv(EnvEnable) == "" {
+		t.Skipf("skipping e2e test: %s is not set", EnvEnable)
+	}
+	if _, err := exec.LookPath(pebbleCmd); err != nil {
+		t.Skip("skipping e2e test: pebble binary not found on PATH")
+	}
+	if _, err := exec.LookPath(challSrvCmd); err != nil {
+		t.Skip("skipping e2e test: pebble-challtestsrv binary not found on PATH")
+	}
+
+	dir, err := fixturesDir()
+	if err != nil {
+		t.Fatalf("locating e2etest fixtures: %v", err)
+	}
+
+	h := &Harness{
+		t:          t,
+		caCertPath: filepath.Join(dir, "certs", "pebble-ca.pem"),
+	}
+
+	h.challSrv, h.challOut = h.run(challSrvCmd, []string{
+		"-dns01", dns01ListenAddr,
+		"-http01", "",
+		"-tlsalpn01", "",
+		"-management", ":8055",
+	}, nil)
+
+	h.pebble, h.pebbleOut = h.run(pebbleCmd, []string{
+		"-config", filepath.Join(dir, "pebble-config.json"),
+		"-dnsserver", DNS01Resolver,
+	}, []string{"PEBBLE_VA_NOSLEEP=1"})
+
+	h.waitForDirectory()
+
+	t.Cleanup(h.Close)
+
+	return h
+}
+
+// fixturesDir locates the fixtures directory checked in alongside this
+// package, regardless of the caller's working directory.
+func fixturesDir() (string, error) {
+	_, thisFile, _, ok := runtime.Caller(0)
+	if !ok {
+		return "", fmt.Errorf("runtime.Caller failed")
+	}
+	return filepath.Join(filepath.Dir(thisFile), "fixtures"), nil
+}
+
+// run starts name with args and extra environment variables appended to the
+// current process's environment, capturing combined output into a buffer
+// that's dumped on Close if the harness never became healthy.
+func (h *Harness) run(name string, args, env []string) (*exec.Cmd, *bytes.Buffer) {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), env...)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Start(); err != nil {
+		h.t.Fatalf("starting %s: %v", name, err)
+	}
+
+	go func() { _ = cmd.Wait() }()
+
+	return cmd, &out
+}
+
+// waitForDirectory polls Pebble's directory endpoint until it responds or
+// the timeout elapses, dumping both subprocesses' logs on failure.
+func (h *Harness) waitForDirectory() {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp, err := h.HTTPClient().Get(DirectoryURL)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+		}
+
+		if time.Now().After(deadline) {
+			h.t.Fatalf("pebble never became healthy: %v\npebble output:\n%s\nchalltestsrv output:\n%s",
+				err, h.pebbleOut.String(), h.challOut.String())
+		}
+
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// UpdateDNSScript returns the path to the DNS-01 exec-provider script
+// bundled alongside this package's fixtures, for wiring lego's "exec" DNS
+// provider (EXEC_PATH) at pebble-challtestsrv's management API.
+func UpdateDNSScript() (string, error) {
+	dir, err := fixturesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "update-dns.sh"), nil
+}
+
+// CACertPath returns the path to the PEM-encoded CA certificate Pebble's
+// HTTPS listener was issued from, suitable for LEGO_CA_CERTIFICATES.
+func (h *Harness) CACertPath() string {
+	return h.caCertPath
+}
+
+// HTTPClient returns an *http.Client that trusts Pebble's TLS certificate,
+// for talking to the directory endpoint directly (e.g. health checks).
+func (h *Harness) HTTPClient() *http.Client {
+	if h.httpClient != nil {
+		return h.httpClient
+	}
+
+	caPEM, err := os.ReadFile(h.caCertPath)
+	if err != nil {
+		h.t.Fatalf("reading pebble CA fixture: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		h.t.Fatalf("parsing pebble CA fixture")
+	}
+
+	h.httpClient = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	return h.httpClient
+}
+
+// SetTXT publishes value as the TXT record for fqdn (which must end in a
+// dot, as ACME DNS-01 FQDNs do) via pebble-challtestsrv's management API.
+func (h *Harness) SetTXT(fqdn, value string) {
+	h.t.Helper()
+	h.challSrvRequest("/set-txt", map[string]string{"host": fqdn, "value": value})
+}
+
+// ClearTXT retracts the TXT record published by a prior SetTXT for fqdn.
+func (h *Harness) ClearTXT(fqdn string) {
+	h.t.Helper()
+	h.challSrvRequest("/clear-txt", map[string]string{"host": fqdn})
+}
+
+func (h *Harness) challSrvRequest(path string, payload map[string]string) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		h.t.Fatalf("marshaling challtestsrv request: %v", err)
+	}
+
+	resp, err := http.Post("http://"+challSrvMgmtAddr+path, "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		h.t.Fatalf("calling challtestsrv %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		h.t.Fatalf("challtestsrv %s: unexpected status %s", path, resp.Status)
+	}
+}
+
+// Close terminates Pebble and pebble-challtestsrv. It's registered
+// automatically via t.Cleanup by New.
+func (h *Harness) Close() {
+	if h.pebble != nil && h.pebble.Process != nil {
+		_ = h.pebble.Process.Kill()
+	}
+	if h.challSrv != nil && h.challSrv.Process != nil {
+		_ = h.challSrv.Process.Kill()
+	}
+}
@@ -0,0 +1,172 @@
+package e2etest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/smallstep/scep"
+)
+
+// EnrollResult is the outcome of a SCEP enrollment driven by Enroll.
+type EnrollResult struct {
+	// Certificate is the issued leaf certificate. Populated only when
+	// Status is scep.SUCCESS.
+	Certificate *x509.Certificate
+	Status      scep.PKIStatus
+	FailInfo    scep.FailInfo
+}
+
+// Enroll drives a real SCEP enrollment against serverURL for commonName,
+// speaking the wire format internal/scepserver's MakeHTTPHandler serves
+// directly over HTTP: a self-signed certificate is used to sign and decrypt
+// the PKCSReq exchange, since the client has no CA-issued certificate yet.
+// It does not retry on a PENDING response - none of the scep2acme code
+// paths this harness exercises return one.
+func Enroll(ctx context.Context, serverURL, commonName, challengePassword string) (*EnrollResult, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generating client key: %w", err)
+	}
+
+	self, err := selfSignedCert(key, commonName)
+	if err != nil {
+		return nil, fmt.Errorf("generating self-signed cert: %w", err)
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("creating csr: %w", err)
+	}
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, fmt.Errorf("parsing csr: %w", err)
+	}
+
+	caBytes, err := getCACert(ctx, serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("getting CA cert: %w", err)
+	}
+	ca, err := x509.ParseCertificate(caBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CA cert: %w", err)
+	}
+
+	tmpl := &scep.PKIMessage{
+		MessageType: scep.PKCSReq,
+		Recipients:  []*x509.Certificate{ca},
+		SignerKey:   key,
+		SignerCert:  self,
+		CSRReqMessage: &scep.CSRReqMessage{
+			ChallengePassword: challengePassword,
+		},
+	}
+
+	msg, err := scep.NewCSRRequest(csr, tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("building pkiMessage: %w", err)
+	}
+
+	respBytes, err := pkiOperation(ctx, serverURL, msg.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("PKIOperation: %w", err)
+	}
+
+	respMsg, err := scep.ParsePKIMessage(respBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing pkiMessage response: %w", err)
+	}
+
+	if respMsg.PKIStatus == scep.FAILURE {
+		return &EnrollResult{Status: respMsg.PKIStatus, FailInfo: respMsg.FailInfo}, nil
+	}
+
+	if err := respMsg.DecryptPKIEnvelope(self, key); err != nil {
+		return nil, fmt.Errorf("decrypting pkiEnvelope: %w", err)
+	}
+
+	return &EnrollResult{
+		Status:      respMsg.PKIStatus,
+		Certificate: respMsg.CertRepMessage.Certificate,
+	}, nil
+}
+
+// getCACert fetches the RA/CA DER certificate served at serverURL's
+// GetCACert operation - a single leaf, in scep2acme's case, since
+// internal/scep.Depot only ever returns one signing certificate.
+func getCACert(ctx context.Context, serverURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+"?operation=GetCACert", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", res.StatusCode, body)
+	}
+
+	return body, nil
+}
+
+// pkiOperation POSTs a raw SCEP PKIMessage to serverURL's PKIOperation
+// endpoint and returns the raw response message.
+func pkiOperation(ctx context.Context, serverURL string, message []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, serverURL+"?operation=PKIOperation", bytes.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", res.StatusCode, body)
+	}
+
+	return body, nil
+}
+
+// selfSignedCert creates the throwaway self-signed certificate a SCEP
+// client without a CA-issued certificate yet uses to sign and decrypt its
+// enrollment request.
+func selfSignedCert(key *rsa.PrivateKey, commonName string) (*x509.Certificate, error) {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
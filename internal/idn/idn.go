@@ -0,0 +1,28 @@
+// Package idn normalizes internationalized hostnames to their ASCII
+// (punycode) form, so a whitelist entry and a CSR hostname written in
+// either form - "münchen.example" or "xn--mnchen-3ya.example" - compare
+// equal.
+package idn
+
+import "golang.org/x/net/idna"
+
+// ToASCII converts hostname to its ASCII/punycode form. Hostnames that are
+// already ASCII, or that idna can't convert (e.g. a glob or regex pattern
+// rather than a literal hostname), are returned unchanged - this is a
+// best-effort normalization for matching, not validation.
+func ToASCII(hostname string) string {
+	ascii, err := idna.ToASCII(hostname)
+	if err != nil {
+		return hostname
+	}
+	return ascii
+}
+
+// ToASCIISlice applies ToASCII to every element of hostnames.
+func ToASCIISlice(hostnames []string) []string {
+	out := make([]string, len(hostnames))
+	for i, h := range hostnames {
+		out[i] = ToASCII(h)
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+// Package keyprovider abstracts where the RA signing key lives, so the SCEP
+// depot can sign with a key on disk, in a PKCS#11 token, or sealed in a TPM
+// without caring which.
+package keyprovider
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Provider produces the crypto.Signer used to sign issued certificates.
+// Implementations backed by hardware (PKCS11Provider, TPMProvider) never
+// expose the private key material to the caller - only Sign operations are
+// performed through the returned crypto.Signer.
+type Provider interface {
+	Signer(ctx context.Context) (crypto.Signer, error)
+}
+
+// New parses uri and returns the Provider it selects. Supported forms:
+//
+//	/path/to/key.pem                                file, for backwards compatibility
+//	file:///path/to/key.pem                         file
+//	pkcs11://<module path>?slot=<n>&label=<label>&pin-env=<ENVVAR>
+//	tpm://<device path>?handle=<persistent handle>
+//
+// opts are FileOptions (e.g. WithPassphrase) applied when uri resolves to a
+// FileProvider; passing any for a hardware-backed scheme is an error, since
+// a pkcs11/tpm key's material never passes through this package to be
+// decrypted.
+func New(uri string, opts ...FileOption) (Provider, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("keyprovider: parsing %q: %w", uri, err)
+	}
+
+	switch u.Scheme {
+	case "", "file":
+		return NewFileProvider(fileURIPath(u), opts...), nil
+	case "pkcs11":
+		if len(opts) > 0 {
+			return nil, fmt.Errorf("keyprovider: passphrase is only supported for file-backed keys")
+		}
+		return newPKCS11ProviderFromURI(u)
+	case "tpm":
+		if len(opts) > 0 {
+			return nil, fmt.Errorf("keyprovider: passphrase is only supported for file-backed keys")
+		}
+		return newTPMProviderFromURI(u)
+	default:
+		return nil, fmt.Errorf("keyprovider: unsupported scheme %q", u.Scheme)
+	}
+}
+
+// fileURIPath returns the filesystem path encoded by u, supporting both a
+// bare path (no scheme, u.Opaque holds it) and a file:// URI.
+func fileURIPath(u *url.URL) string {
+	if u.Scheme == "" {
+		return u.Path
+	}
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+	return u.Path
+}
+
+func queryUint(u *url.URL, key string, def uint) (uint, error) {
+	v := u.Query().Get(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(v, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("keyprovider: parsing %s=%q: %w", key, v, err)
+	}
+	return uint(n), nil
+}
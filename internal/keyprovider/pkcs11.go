@@ -0,0 +1,199 @@
+package keyprovider
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS11Provider signs through a key held in a PKCS#11 token or HSM. The key
+// is located by slot and/or label and never leaves the token - only Sign
+// operations cross the PKCS#11 boundary.
+type PKCS11Provider struct {
+	modulePath string
+	slot       uint
+	label      string
+	pinEnv     string
+}
+
+// NewPKCS11Provider creates a Provider backed by the PKCS#11 module at
+// modulePath. pinEnv names the environment variable holding the token PIN,
+// so the PIN itself never appears in a config file or process listing.
+func NewPKCS11Provider(modulePath string, slot uint, label, pinEnv string) *PKCS11Provider {
+	return &PKCS11Provider{
+		modulePath: modulePath,
+		slot:       slot,
+		label:      label,
+		pinEnv:     pinEnv,
+	}
+}
+
+// newPKCS11ProviderFromURI builds a PKCS11Provider from a
+// pkcs11://<module path>?slot=<n>&label=<label>&pin-env=<ENVVAR> URI.
+func newPKCS11ProviderFromURI(u *url.URL) (*PKCS11Provider, error) {
+	slot, err := queryUint(u, "slot", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	pinEnv := u.Query().Get("pin-env")
+	if pinEnv == "" {
+		return nil, fmt.Errorf("keyprovider: pkcs11 uri missing pin-env parameter")
+	}
+
+	return NewPKCS11Provider(fileURIPath(u), slot, u.Query().Get("label"), pinEnv), nil
+}
+
+// Signer implements Provider. It opens a session against the token, logs in
+// using the PIN read from pinEnv, and returns a crypto.Signer that signs
+// through that session.
+func (p *PKCS11Provider) Signer(_ context.Context) (crypto.Signer, error) {
+	pin := os.Getenv(p.pinEnv)
+	if pin == "" {
+		return nil, fmt.Errorf("keyprovider: pkcs11: %s is not set", p.pinEnv)
+	}
+
+	ctx := pkcs11.New(p.modulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("keyprovider: pkcs11: loading module %q", p.modulePath)
+	}
+	if err := ctx.Initialize(); err != nil {
+		return nil, fmt.Errorf("keyprovider: pkcs11: initializing module: %w", err)
+	}
+
+	session, err := ctx.OpenSession(p.slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("keyprovider: pkcs11: opening session: %w", err)
+	}
+
+	if err := ctx.Login(session, pkcs11.CKU_USER, pin); err != nil {
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return nil, fmt.Errorf("keyprovider: pkcs11: login: %w", err)
+	}
+
+	privHandle, pubHandle, err := findKeyPair(ctx, session, p.label)
+	if err != nil {
+		ctx.Logout(session)
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return nil, err
+	}
+
+	pub, err := readRSAPublicKey(ctx, session, pubHandle)
+	if err != nil {
+		ctx.Logout(session)
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return nil, err
+	}
+
+	return &pkcs11Signer{ctx: ctx, session: session, handle: privHandle, public: pub}, nil
+}
+
+// findKeyPair locates the private and public key objects with the given
+// CKA_LABEL in the current session.
+func findKeyPair(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, label string) (priv, pub pkcs11.ObjectHandle, err error) {
+	priv, err = findObject(ctx, session, pkcs11.CKO_PRIVATE_KEY, label)
+	if err != nil {
+		return 0, 0, fmt.Errorf("keyprovider: pkcs11: finding private key %q: %w", label, err)
+	}
+
+	pub, err = findObject(ctx, session, pkcs11.CKO_PUBLIC_KEY, label)
+	if err != nil {
+		return 0, 0, fmt.Errorf("keyprovider: pkcs11: finding public key %q: %w", label, err)
+	}
+
+	return priv, pub, nil
+}
+
+func findObject(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, class uint, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+	}
+	if label != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, label))
+	}
+
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, err
+	}
+	defer ctx.FindObjectsFinal(session)
+
+	objs, _, err := ctx.FindObjects(session, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(objs) == 0 {
+		return 0, fmt.Errorf("no object found")
+	}
+
+	return objs[0], nil
+}
+
+func readRSAPublicKey(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, handle pkcs11.ObjectHandle) (*rsa.PublicKey, error) {
+	attrs, err := ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("keyprovider: pkcs11: reading public key: %w", err)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attrs[0].Value),
+		E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+	}, nil
+}
+
+// hashPrefixes holds the DigestInfo ASN.1 prefixes CKM_RSA_PKCS expects
+// ahead of the raw digest, taken from RFC 8017 section 9.2.
+var hashPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// pkcs11Signer implements crypto.Signer for a key held in a PKCS#11 token.
+type pkcs11Signer struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	handle  pkcs11.ObjectHandle
+	public  *rsa.PublicKey
+}
+
+// Public implements crypto.Signer.
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign implements crypto.Signer, delegating the signature operation to the
+// token so the private key material never leaves it.
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, fmt.Errorf("keyprovider: pkcs11: RSA-PSS is not supported")
+	}
+
+	prefix, ok := hashPrefixes[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("keyprovider: pkcs11: unsupported hash %v", opts.HashFunc())
+	}
+
+	// CKM_RSA_PKCS performs raw RSASSA-PKCS1-v1_5 and expects the caller to
+	// supply the DigestInfo ASN.1 prefix ahead of the digest itself.
+	digestInfo := append(append([]byte{}, prefix...), digest...)
+
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)}, s.handle); err != nil {
+		return nil, fmt.Errorf("keyprovider: pkcs11: sign init: %w", err)
+	}
+
+	return s.ctx.Sign(s.session, digestInfo)
+}
@@ -0,0 +1,121 @@
+package keyprovider
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// TPMProvider signs through an RSA key sealed under a persistent handle in a
+// TPM 2.0 device. The key never leaves the TPM; only Sign commands cross the
+// device boundary.
+type TPMProvider struct {
+	devicePath string
+	handle     tpmutil.Handle
+}
+
+// NewTPMProvider creates a Provider backed by the TPM at devicePath (e.g.
+// /dev/tpmrm0), using the key stored under the given persistent handle.
+func NewTPMProvider(devicePath string, handle tpmutil.Handle) *TPMProvider {
+	return &TPMProvider{devicePath: devicePath, handle: handle}
+}
+
+// newTPMProviderFromURI builds a TPMProvider from a
+// tpm://<device path>?handle=<persistent handle> URI.
+func newTPMProviderFromURI(u *url.URL) (*TPMProvider, error) {
+	handle, err := queryUint(u, "handle", 0)
+	if err != nil {
+		return nil, err
+	}
+	if handle == 0 {
+		return nil, fmt.Errorf("keyprovider: tpm uri missing handle parameter")
+	}
+
+	devicePath := fileURIPath(u)
+	if devicePath == "" {
+		devicePath = "/dev/tpmrm0"
+	}
+
+	return NewTPMProvider(devicePath, tpmutil.Handle(handle)), nil
+}
+
+// Signer implements Provider. It opens the TPM device and reads the public
+// area of the key under handle; signing happens lazily per-call against a
+// freshly opened device, since go-tpm's io.ReadWriteCloser isn't safe to
+// hold open across the lifetime of the process.
+func (p *TPMProvider) Signer(_ context.Context) (crypto.Signer, error) {
+	rwc, err := tpmutil.OpenTPM(p.devicePath)
+	if err != nil {
+		return nil, fmt.Errorf("keyprovider: tpm: opening %s: %w", p.devicePath, err)
+	}
+	defer rwc.Close()
+
+	pub, _, _, err := tpm2.ReadPublic(rwc, p.handle)
+	if err != nil {
+		return nil, fmt.Errorf("keyprovider: tpm: reading public area of handle %#x: %w", p.handle, err)
+	}
+
+	pubKey, err := pub.Key()
+	if err != nil {
+		return nil, fmt.Errorf("keyprovider: tpm: decoding public key: %w", err)
+	}
+
+	rsaPub, ok := pubKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("keyprovider: tpm: handle %#x holds a %T key, only RSA is supported", p.handle, pubKey)
+	}
+
+	return &tpmSigner{devicePath: p.devicePath, handle: p.handle, public: rsaPub}, nil
+}
+
+// tpmSigner implements crypto.Signer for a key held in a TPM 2.0 device.
+type tpmSigner struct {
+	devicePath string
+	handle     tpmutil.Handle
+	public     *rsa.PublicKey
+}
+
+// Public implements crypto.Signer.
+func (s *tpmSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign implements crypto.Signer, delegating the signature operation to the
+// TPM so the private key material never leaves it.
+func (s *tpmSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, fmt.Errorf("keyprovider: tpm: RSA-PSS is not supported")
+	}
+
+	alg, ok := tpmHashAlgs[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("keyprovider: tpm: unsupported hash %v", opts.HashFunc())
+	}
+
+	rwc, err := tpmutil.OpenTPM(s.devicePath)
+	if err != nil {
+		return nil, fmt.Errorf("keyprovider: tpm: opening %s: %w", s.devicePath, err)
+	}
+	defer rwc.Close()
+
+	sig, err := tpm2.Sign(rwc, s.handle, "", digest, nil, &tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: alg})
+	if err != nil {
+		return nil, fmt.Errorf("keyprovider: tpm: sign: %w", err)
+	}
+
+	return sig.RSA.Signature, nil
+}
+
+// tpmHashAlgs maps a crypto.Hash to the TPM_ALG_ID used in the signing
+// scheme.
+var tpmHashAlgs = map[crypto.Hash]tpm2.Algorithm{
+	crypto.SHA256: tpm2.AlgSHA256,
+	crypto.SHA384: tpm2.AlgSHA384,
+	crypto.SHA512: tpm2.AlgSHA512,
+}
@@ -0,0 +1,111 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteCABundle writes ca.pem and ca.key (PKCS#8) to dir. The CA key only
+// needs to exist on disk for a later renew-ra - operators who want the CA
+// kept offline or in an HSM can move or delete ca.key afterwards and pass
+// -cakey pointing at wherever they put it instead.
+func WriteCABundle(dir string, ca *x509.Certificate, caKey crypto.Signer) error {
+	if err := writeCertPEM(filepath.Join(dir, "ca.pem"), ca); err != nil {
+		return fmt.Errorf("writing ca.pem: %w", err)
+	}
+	if err := writeKeyPEM(filepath.Join(dir, "ca.key"), caKey); err != nil {
+		return fmt.Errorf("writing ca.key: %w", err)
+	}
+	return nil
+}
+
+// WriteRABundle writes ra.pem, the combined ra+ca.pem and ra.key (PKCS#8) to
+// dir. ra+ca.pem is ordered RA certificate then CA certificate, the order
+// internal/scep.Depot's -cert flag expects.
+func WriteRABundle(dir string, ra, ca *x509.Certificate, raKey crypto.Signer) error {
+	if err := writeCertPEM(filepath.Join(dir, "ra.pem"), ra); err != nil {
+		return fmt.Errorf("writing ra.pem: %w", err)
+	}
+
+	combined := append(certPEM(ra), certPEM(ca)...)
+	if err := os.WriteFile(filepath.Join(dir, "ra+ca.pem"), combined, 0o644); err != nil {
+		return fmt.Errorf("writing ra+ca.pem: %w", err)
+	}
+
+	if err := writeKeyPEM(filepath.Join(dir, "ra.key"), raKey); err != nil {
+		return fmt.Errorf("writing ra.key: %w", err)
+	}
+
+	return nil
+}
+
+// WriteBundle writes both the CA bundle and the RA bundle to dir, as
+// init-ra does for a freshly minted pair.
+func WriteBundle(dir string, ca *x509.Certificate, caKey crypto.Signer, ra *x509.Certificate, raKey crypto.Signer) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("creating output dir: %w", err)
+	}
+	if err := WriteCABundle(dir, ca, caKey); err != nil {
+		return err
+	}
+	return WriteRABundle(dir, ra, ca, raKey)
+}
+
+// LoadCertificate reads a single PEM-encoded certificate from path.
+func LoadCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("pki: no PEM certificate found in %s", path)
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func certPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// writeCertPEM PEM-encodes cert and writes it to path.
+func writeCertPEM(path string, cert *x509.Certificate) error {
+	return os.WriteFile(path, certPEM(cert), 0o644)
+}
+
+// writeKeyPEM marshals key as PKCS#8 and atomically writes it to path,
+// restricted to the owner - mirroring acme.saveAccount's
+// temp-file-then-rename pattern so a crash mid-write can't leave a
+// truncated key on disk.
+func writeKeyPEM(path string, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("marshaling key: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating temp key file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing key file: %w", err)
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("chmod key file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing key file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,179 @@
+// Package pki mints the self-signed CA and RA certificate pair the scep2acme
+// SCEP depot (internal/scep.Depot) expects at -cert, for the `init-ra` and
+// `renew-ra` subcommands. It has no dependency on the rest of scep2acme - it
+// only knows how to build and load certificates.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// KeyType selects the key algorithm and size minted for a CA or RA key.
+type KeyType string
+
+// Supported KeyType values.
+const (
+	RSA2048   KeyType = "rsa2048"
+	RSA3072   KeyType = "rsa3072"
+	RSA4096   KeyType = "rsa4096"
+	ECDSAP256 KeyType = "ecdsa-p256"
+	ECDSAP384 KeyType = "ecdsa-p384"
+)
+
+// GenerateKey mints a new private key of the given type.
+func GenerateKey(keyType KeyType) (crypto.Signer, error) {
+	switch keyType {
+	case RSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case RSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case RSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case ECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("pki: unsupported key type %q", keyType)
+	}
+}
+
+// Subject holds the certificate subject fields init-ra/renew-ra expose as
+// flags.
+type Subject struct {
+	CommonName   string
+	Organization string
+	Country      string
+}
+
+func (s Subject) pkixName() pkix.Name {
+	name := pkix.Name{CommonName: s.CommonName}
+	if s.Organization != "" {
+		name.Organization = []string{s.Organization}
+	}
+	if s.Country != "" {
+		name.Country = []string{s.Country}
+	}
+	return name
+}
+
+// CAOptions configures CreateCA.
+type CAOptions struct {
+	KeyType        KeyType
+	Subject        Subject
+	Validity       time.Duration
+	MaxPathLen     int  // -1 omits the pathLenConstraint, matching x509.Certificate's own convention
+	MaxPathLenZero bool // encodes an explicit pathLenConstraint of 0, forbidding intermediates
+}
+
+// CreateCA mints a new self-signed CA certificate and key.
+func CreateCA(opts CAOptions) (*x509.Certificate, crypto.Signer, error) {
+	key, err := GenerateKey(opts.KeyType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating CA key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      opts.Subject.pkixName(),
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(opts.Validity),
+		// Only the CA template gets CertSign/CRLSign - the RA signs nothing
+		// itself, it only decrypts and signs SCEP protocol messages.
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            opts.MaxPathLen,
+		MaxPathLenZero:        opts.MaxPathLenZero,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating CA certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing CA certificate: %w", err)
+	}
+
+	return cert, key, nil
+}
+
+// RAOptions configures CreateRA.
+type RAOptions struct {
+	KeyType     KeyType
+	Subject     Subject
+	Validity    time.Duration
+	DNSNames    []string
+	IPAddresses []net.IP
+}
+
+// CreateRA mints an RA certificate signed by ca/caKey.
+func CreateRA(ca *x509.Certificate, caKey crypto.Signer, opts RAOptions) (*x509.Certificate, crypto.Signer, error) {
+	key, err := GenerateKey(opts.KeyType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating RA key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      opts.Subject.pkixName(),
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(opts.Validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		DNSNames:     opts.DNSNames,
+		IPAddresses:  opts.IPAddresses,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, key.Public(), caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating RA certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing RA certificate: %w", err)
+	}
+
+	return cert, key, nil
+}
+
+// NeedsRenewal reports whether cert expires within the given window.
+func NeedsRenewal(cert *x509.Certificate, within time.Duration) bool {
+	return time.Until(cert.NotAfter) < within
+}
+
+// randomSerial returns a random 128-bit positive serial number, as
+// recommended by CA/Browser Forum guidelines.
+func randomSerial() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serial, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %w", err)
+	}
+	return serial, nil
+}
@@ -0,0 +1,20 @@
+// Package reqid carries a per-request ID through a context.Context, from the
+// HTTP middleware that assigns it (see internal/server) to anything handling
+// the request downstream (the SCEP endpoints, the ACME certificate source).
+package reqid
+
+import "context"
+
+type key struct{}
+
+// WithValue returns a copy of ctx carrying id, retrievable with FromContext.
+func WithValue(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, key{}, id)
+}
+
+// FromContext returns the request ID stashed by WithValue, or "" if ctx
+// doesn't carry one.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(key{}).(string)
+	return id
+}
@@ -2,49 +2,90 @@ package scep
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"math/big"
 	"os"
+	"path/filepath"
 	"strings"
 
-	scepserver "github.com/micromdm/scep/server"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"go.bog.dev/scep2acme/internal/keyprovider"
 )
 
-// ServiceWithoutRenewal wraps a SCEP service and disables renewal capability
-type ServiceWithoutRenewal struct {
-	scepserver.Service
+// Depot implements the SCEP depot interface for certificate management. Its
+// RA key and cert chain come from either a PEM cert chain (certPath) plus a
+// key resolved via keyprovider.New, or - if pkcs12Path is set - a single
+// PKCS#12 bundle containing both, picked by CA based on which NewDepot
+// constructor was used.
+type Depot struct {
+	certPath string
+	key      keyprovider.Provider
+
+	pkcs12Path       string
+	pkcs12Passphrase []byte
 }
 
-// GetCACaps returns CA capabilities without renewal support
-func (s ServiceWithoutRenewal) GetCACaps(ctx context.Context) ([]byte, error) {
-	capsBytes, err := s.Service.GetCACaps(ctx)
+// NewDepot creates a new SCEP depot whose RA cert chain is the PEM file at
+// certPath and whose RA key is certKeyURI, resolved via keyprovider.New so
+// it accepts a plain path, a file:// URI, or a pkcs11:// / tpm:// URI for a
+// hardware-backed RA key. opts are FileOptions - currently only
+// keyprovider.WithPassphrase, for an encrypted PKCS#8 certKeyURI - applied
+// when certKeyURI resolves to a file-backed key.
+func NewDepot(certPath, certKeyURI string, opts ...keyprovider.FileOption) (*Depot, error) {
+	key, err := keyprovider.New(certKeyURI, opts...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("setting up RA key: %w", err)
 	}
 
-	newCaps := strings.ReplaceAll(" "+string(capsBytes)+" ", "\nRenewal\n", "\n")
-	return []byte(newCaps[1 : len(newCaps)-1]), nil
+	return &Depot{
+		certPath: certPath,
+		key:      key,
+	}, nil
 }
 
-// Depot implements the SCEP depot interface for certificate management
-type Depot struct {
-	certPath    string
-	certKeyPath string
+// NewDepotFromPKCS12 creates a new SCEP depot whose RA key, RA certificate
+// and CA chain are all read together from the PKCS#12 bundle at path,
+// decrypted with passphrase - for operators who'd rather ship one file than
+// separate RA cert/key files.
+func NewDepotFromPKCS12(path string, passphrase []byte) *Depot {
+	return &Depot{
+		pkcs12Path:       path,
+		pkcs12Passphrase: passphrase,
+	}
 }
 
-// NewDepot creates a new SCEP depot
-func NewDepot(certPath, certKeyPath string) *Depot {
-	return &Depot{
-		certPath:    certPath,
-		certKeyPath: certKeyPath,
+// IsPKCS12Path reports whether path's extension marks it as a PKCS#12
+// bundle (.p12 or .pfx), for callers deciding between NewDepot and
+// NewDepotFromPKCS12 based on a single configured path.
+func IsPKCS12Path(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".p12", ".pfx":
+		return true
+	default:
+		return false
 	}
 }
 
-// CA returns the CA certificate chain and private key
-func (d *Depot) CA(_ []byte) ([]*x509.Certificate, *rsa.PrivateKey, error) {
+// CA returns the CA certificate chain and RA signing key. Both RSA and EC
+// (P-256/P-384) keys are supported here - but note that SCEP's PKCS#7
+// envelope key transport is RSA-only by construction, so an EC RA key can
+// sign CertRep messages while still failing to decrypt PKCSReq/RenewalReq
+// requests; that constraint lives in the scep package's
+// DecryptPKIEnvelope, not here.
+func (d *Depot) CA(_ []byte) ([]*x509.Certificate, crypto.Signer, error) {
+	if d.pkcs12Path != "" {
+		return d.caFromPKCS12()
+	}
+	return d.caFromPEM()
+}
+
+// caFromPEM implements CA for a Depot built via NewDepot: the RA/CA chain
+// comes from the PEM file at certPath, the RA key from d.key.
+func (d *Depot) caFromPEM() ([]*x509.Certificate, crypto.Signer, error) {
 	caPEM, err := os.ReadFile(d.certPath)
 	if err != nil {
 		return nil, nil, err
@@ -54,40 +95,33 @@ func (d *Depot) CA(_ []byte) ([]*x509.Certificate, *rsa.PrivateKey, error) {
 		return nil, nil, err
 	}
 
-	keyPEM, err := os.ReadFile(d.certKeyPath)
+	signer, err := d.key.Signer(context.Background())
 	if err != nil {
-		return nil, nil, err
-	}
-	key, err := d.loadKey(keyPEM, nil)
-	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("loading RA key: %w", err)
 	}
 
-	return certs, key, nil
+	return certs, signer, nil
 }
 
-// loadKey loads a private key from PEM data
-func (d *Depot) loadKey(data []byte, _ []byte) (*rsa.PrivateKey, error) {
-	pemBlock, _ := pem.Decode(data)
-	if pemBlock == nil {
-		return nil, fmt.Errorf("PEM decode failed")
-	}
-
-	if pemBlock.Type == "RSA PRIVATE KEY" {
-		return x509.ParsePKCS1PrivateKey(pemBlock.Bytes)
+// caFromPKCS12 implements CA for a Depot built via NewDepotFromPKCS12: the
+// RA key, RA cert and CA chain all come from one PKCS#12 bundle.
+func (d *Depot) caFromPKCS12() ([]*x509.Certificate, crypto.Signer, error) {
+	data, err := os.ReadFile(d.pkcs12Path)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	ret, err := x509.ParsePKCS8PrivateKey(pemBlock.Bytes)
+	key, raCert, caCerts, err := pkcs12.DecodeChain(data, string(d.pkcs12Passphrase))
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("decoding pkcs12 bundle %s: %w", d.pkcs12Path, err)
 	}
 
-	rsaKey, ok := ret.(*rsa.PrivateKey)
+	signer, ok := key.(crypto.Signer)
 	if !ok {
-		return nil, fmt.Errorf("key is not an RSA private key")
+		return nil, nil, fmt.Errorf("pkcs12 bundle %s: key type %T does not implement crypto.Signer", d.pkcs12Path, key)
 	}
 
-	return rsaKey, nil
+	return append([]*x509.Certificate{raCert}, caCerts...), signer, nil
 }
 
 // loadCerts loads certificates from PEM data
@@ -0,0 +1,108 @@
+package scep
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// generateCAAndRA mints a minimal self-signed CA and an RA certificate it
+// signs, for exercising Depot.CA without a real PKI.
+func generateCAAndRA(t *testing.T) (caCert *x509.Certificate, raCert *x509.Certificate, raKey *rsa.PrivateKey) {
+	t.Helper()
+
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err = x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	raKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	raTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test RA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	raDER, err := x509.CreateCertificate(rand.Reader, raTemplate, caCert, &raKey.PublicKey, caKey)
+	require.NoError(t, err)
+	raCert, err = x509.ParseCertificate(raDER)
+	require.NoError(t, err)
+
+	return caCert, raCert, raKey
+}
+
+func TestDepotCAFromPEM(t *testing.T) {
+	caCert, raCert, raKey := generateCAAndRA(t)
+	dir := t.TempDir()
+
+	certPath := filepath.Join(dir, "bundle.pem")
+	var bundle []byte
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raCert.Raw})...)
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})...)
+	require.NoError(t, os.WriteFile(certPath, bundle, 0o600))
+
+	keyPath := filepath.Join(dir, "ra.key")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(raKey)})
+	require.NoError(t, os.WriteFile(keyPath, keyPEM, 0o600))
+
+	depot, err := NewDepot(certPath, keyPath)
+	require.NoError(t, err)
+
+	certs, signer, err := depot.CA(nil)
+	require.NoError(t, err)
+	require.Len(t, certs, 2)
+	require.Equal(t, raCert.Raw, certs[0].Raw)
+	require.Equal(t, caCert.Raw, certs[1].Raw)
+	require.Equal(t, raKey.Public(), signer.Public())
+}
+
+func TestDepotCAFromPKCS12(t *testing.T) {
+	caCert, raCert, raKey := generateCAAndRA(t)
+	dir := t.TempDir()
+
+	bundle, err := pkcs12.Encode(rand.Reader, raKey, raCert, []*x509.Certificate{caCert}, "hunter2")
+	require.NoError(t, err)
+
+	pkcs12Path := filepath.Join(dir, "ra.p12")
+	require.NoError(t, os.WriteFile(pkcs12Path, bundle, 0o600))
+
+	depot := NewDepotFromPKCS12(pkcs12Path, []byte("hunter2"))
+
+	certs, signer, err := depot.CA(nil)
+	require.NoError(t, err)
+	require.Len(t, certs, 2)
+	require.Equal(t, raCert.Raw, certs[0].Raw)
+	require.Equal(t, caCert.Raw, certs[1].Raw)
+	require.Equal(t, raKey.Public(), signer.Public())
+}
+
+func TestIsPKCS12Path(t *testing.T) {
+	require.True(t, IsPKCS12Path("ra.p12"))
+	require.True(t, IsPKCS12Path("RA.PFX"))
+	require.False(t, IsPKCS12Path("ra.pem"))
+}
@@ -0,0 +1,58 @@
+package scepserver
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Endpoints wraps a Service as a pair of go-kit endpoints, one per HTTP
+// method SCEP clients may use, so request-logging middleware can wrap them
+// uniformly.
+type Endpoints struct {
+	GetEndpoint  endpoint.Endpoint
+	PostEndpoint endpoint.Endpoint
+}
+
+func MakeServerEndpoints(svc Service) *Endpoints {
+	e := makeSCEPEndpoint(svc)
+	return &Endpoints{
+		GetEndpoint:  e,
+		PostEndpoint: e,
+	}
+}
+
+func makeSCEPEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(SCEPRequest)
+		resp := SCEPResponse{operation: req.Operation}
+		switch req.Operation {
+		case "GetCACaps":
+			resp.Data, resp.Err = svc.GetCACaps(ctx)
+		case "GetCACert":
+			resp.Data, resp.CACertNum, resp.Err = svc.GetCACert(ctx)
+		case "PKIOperation":
+			resp.Data, resp.Err = svc.PKIOperation(ctx, req.Message)
+		default:
+			return nil, errors.New("scep: operation not implemented")
+		}
+		return resp, nil
+	}
+}
+
+// SCEPRequest is a SCEP server request.
+type SCEPRequest struct {
+	Operation string
+	Message   []byte
+}
+
+// SCEPResponse is a SCEP server response. Business errors are encoded as a
+// CertRep message with pkiStatus FAILURE and a failInfo attribute, not as
+// Err - Err is reserved for transport-level failures.
+type SCEPResponse struct {
+	operation string
+	CACertNum int
+	Data      []byte
+	Err       error
+}
@@ -0,0 +1,328 @@
+// Package scepserver implements the SCEP HTTP server: the go-kit Service,
+// endpoints and transport that turn a Depot and a CertificateSource into a
+// working /scep HTTP handler.
+//
+// github.com/micromdm/scep/server (and its message-encoding dependency,
+// github.com/micromdm/scep/scep) is unmaintained; the SCEP wire-format
+// primitives it used to wrap now live on in github.com/smallstep/scep, but
+// smallstep deliberately dropped the server/depot/csrverifier/client layers
+// when it extracted that core - see https://github.com/smallstep/scep. This
+// package is scep2acme's own replacement for that layer, built on
+// smallstep/scep, trimmed to what scep2acme actually uses (no dynamic
+// challenge store, no SCEP client). Unlike the old server package, Depot's
+// CA key is a crypto.Signer rather than a hard-coded *rsa.PrivateKey, so an
+// EC (P-256/P-384) RA key can sign CertRep messages - DecryptPKIEnvelope
+// still requires an RSA key, since PKCS#7 envelope key transport is
+// RSA-only by construction, regardless of RA key type.
+package scepserver
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/smallstep/scep"
+)
+
+// Service is the interface for all supported SCEP server operations.
+type Service interface {
+	// GetCACaps returns a list of options which are supported by the server.
+	GetCACaps(ctx context.Context) ([]byte, error)
+
+	// GetCACert returns the CA certificate, or a CA certificate chain with
+	// intermediates, in PKCS#7 Degenerate Certificates format.
+	GetCACert(ctx context.Context) ([]byte, int, error)
+
+	// PKIOperation handles incoming SCEP messages such as PKCSReq and sends
+	// back a CertRep PKIMessage.
+	PKIOperation(ctx context.Context, msg []byte) ([]byte, error)
+
+	// GetNextCACert returns a replacement certificate or certificate chain
+	// when the old one expires. The response format is a PKCS#7 Degenerate
+	// Certificates type.
+	GetNextCACert(ctx context.Context) ([]byte, error)
+}
+
+// CertificateSource obtains the certificate to return for a decrypted SCEP
+// request.
+type CertificateSource interface {
+	ObtainCertificate(ctx context.Context, msg *scep.PKIMessage) (*x509.Certificate, error)
+}
+
+// CertificateSourceFunc adapts a function to a CertificateSource.
+type CertificateSourceFunc func(ctx context.Context, msg *scep.PKIMessage) (*x509.Certificate, error)
+
+// ObtainCertificate implements CertificateSource.
+func (f CertificateSourceFunc) ObtainCertificate(ctx context.Context, msg *scep.PKIMessage) (*x509.Certificate, error) {
+	return f(ctx, msg)
+}
+
+// CSRVerifier verifies the raw decrypted CSR bytes of a SCEP request.
+type CSRVerifier interface {
+	Verify(data []byte) (bool, error)
+}
+
+// Depot is a repository for managing certificates. CA's key is a
+// crypto.Signer rather than a concrete key type, so RSA and EC RA keys are
+// both supported.
+type Depot interface {
+	CA(pass []byte) ([]*x509.Certificate, crypto.Signer, error)
+	Put(name string, crt *x509.Certificate) error
+	Serial() (*big.Int, error)
+	HasCN(cn string, allowTime int, cert *x509.Certificate, revokeOldCertificate bool) (bool, error)
+}
+
+type service struct {
+	depot             Depot
+	ca                []*x509.Certificate // CA cert or chain
+	caKey             crypto.Signer
+	caKeyPassword     []byte
+	challengePassword string
+	csrVerifier       CSRVerifier
+	certificateSource CertificateSource
+	allowRenewal      int // days before expiry, 0 to disable
+	clientValidity    int // client cert validity in days
+
+	// info logging is implemented in the service middleware layer.
+	debugLogger log.Logger
+}
+
+func (svc *service) GetCACaps(ctx context.Context) ([]byte, error) {
+	defaultCaps := []byte("Renewal\nSHA-1\nSHA-256\nAES\nDES3\nSCEPStandard\nPOSTPKIOperation")
+	return defaultCaps, nil
+}
+
+func (svc *service) GetCACert(ctx context.Context) ([]byte, int, error) {
+	if len(svc.ca) == 0 {
+		return nil, 0, errors.New("missing CA cert")
+	}
+	if len(svc.ca) == 1 {
+		return svc.ca[0].Raw, 1, nil
+	}
+	data, err := scep.DegenerateCertificates(svc.ca)
+	return data, len(svc.ca), err
+}
+
+func (svc *service) PKIOperation(ctx context.Context, data []byte) ([]byte, error) {
+	msg, err := scep.ParsePKIMessage(data, scep.WithLogger(svc.debugLogger))
+	if err != nil {
+		return nil, err
+	}
+	ca := svc.ca[0]
+	if err := msg.DecryptPKIEnvelope(ca, svc.caKey); err != nil {
+		return nil, err
+	}
+
+	// Validate the challenge password.
+	if msg.MessageType == scep.PKCSReq {
+		csrIsValid := false
+
+		if svc.csrVerifier != nil {
+			result, err := svc.csrVerifier.Verify(msg.CSRReqMessage.RawDecrypted)
+			if err != nil {
+				return nil, err
+			}
+			csrIsValid = result
+			if !csrIsValid {
+				svc.debugLogger.Log("err", "CSR is not valid")
+			}
+		} else {
+			csrIsValid = svc.challengePassword == "" || svc.challengePassword == msg.CSRReqMessage.ChallengePassword
+			if !csrIsValid {
+				svc.debugLogger.Log("err", "scep challenge password does not match")
+			}
+		}
+
+		if !csrIsValid {
+			certRep, err := msg.Fail(ca, svc.caKey, scep.BadRequest)
+			if err != nil {
+				return nil, err
+			}
+			return certRep.Raw, nil
+		}
+	}
+
+	certSrc := svc.certificateSource
+	if certSrc == nil {
+		certSrc = CertificateSourceFunc(svc.createCertificate)
+	}
+
+	crt, err := certSrc.ObtainCertificate(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	name := certName(crt)
+
+	certRep, err := msg.Success(ca, svc.caKey, crt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test if this certificate is already in the CADB, revoke if needed.
+	// Revocation is done if the validity of the existing certificate is
+	// less than allowRenewal (14 days by default).
+	if _, err := svc.depot.HasCN(name, svc.allowRenewal, crt, false); err != nil {
+		return nil, err
+	}
+
+	if err := svc.depot.Put(name, crt); err != nil {
+		return nil, err
+	}
+
+	return certRep.Raw, nil
+}
+
+// createCertificate is the fallback CertificateSource used when none is
+// configured via WithCertificateSource: it signs the CSR directly with the
+// CA key.
+func (svc *service) createCertificate(ctx context.Context, msg *scep.PKIMessage) (*x509.Certificate, error) {
+	ca := svc.ca[0]
+	csr := msg.CSRReqMessage.CSR
+
+	id, err := generateSubjectKeyID(csr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := svc.depot.Serial()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-600).UTC(),
+		NotAfter:     time.Now().AddDate(0, 0, svc.clientValidity).UTC(),
+		SubjectKeyId: id,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageClientAuth,
+		},
+	}
+
+	crtBytes, err := x509.CreateCertificate(rand.Reader, tmpl, ca, csr.PublicKey, svc.caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(crtBytes)
+}
+
+func certName(crt *x509.Certificate) string {
+	if crt.Subject.CommonName != "" {
+		return crt.Subject.CommonName
+	}
+	return string(crt.Signature)
+}
+
+func (svc *service) GetNextCACert(ctx context.Context) ([]byte, error) {
+	panic("not implemented")
+}
+
+// ServiceOption is a server configuration option.
+type ServiceOption func(*service) error
+
+// WithCSRVerifier sets the CSR verifier used to decide whether a PKCSReq is
+// allowed, in place of a static ChallengePassword.
+func WithCSRVerifier(csrVerifier CSRVerifier) ServiceOption {
+	return func(s *service) error {
+		s.csrVerifier = csrVerifier
+		return nil
+	}
+}
+
+// ChallengePassword sets a preshared key for SCEP, checked when no
+// CSRVerifier is configured.
+func ChallengePassword(pw string) ServiceOption {
+	return func(s *service) error {
+		s.challengePassword = pw
+		return nil
+	}
+}
+
+// CAKeyPassword specifies the CA private key password.
+func CAKeyPassword(pw []byte) ServiceOption {
+	return func(s *service) error {
+		s.caKeyPassword = pw
+		return nil
+	}
+}
+
+// AllowRenewal sets the number of days before expiry a certificate may be
+// renewed, used by the fallback CertificateSource. 0 disables renewal.
+func AllowRenewal(days int) ServiceOption {
+	return func(s *service) error {
+		s.allowRenewal = days
+		return nil
+	}
+}
+
+// ClientValidity sets the validity, in days, of certificates signed by the
+// fallback CertificateSource.
+func ClientValidity(days int) ServiceOption {
+	return func(s *service) error {
+		s.clientValidity = days
+		return nil
+	}
+}
+
+// WithLogger configures a logger for the SCEP Service. By default, a no-op
+// logger is used.
+func WithLogger(logger log.Logger) ServiceOption {
+	return func(s *service) error {
+		s.debugLogger = logger
+		return nil
+	}
+}
+
+// WithCertificateSource sets the CertificateSource consulted to obtain the
+// certificate to issue for a PKCSReq, in place of signing the CSR directly
+// with the CA key.
+func WithCertificateSource(source CertificateSource) ServiceOption {
+	return func(s *service) error {
+		s.certificateSource = source
+		return nil
+	}
+}
+
+// NewService creates a new SCEP service.
+func NewService(depot Depot, opts ...ServiceOption) (Service, error) {
+	s := &service{
+		depot:       depot,
+		debugLogger: log.NewNopLogger(),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	s.ca, s.caKey, err = depot.CA(s.caKeyPassword)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// generateSubjectKeyID computes the SubjectKeyId used in a certificate
+// signed by the fallback CertificateSource: the SHA-1 hash of the DER
+// SubjectPublicKeyInfo, which - unlike hashing a hand-rolled PKCS#1
+// structure - works for any public key type the CSR might carry (RSA, EC,
+// Ed25519), not only RSA.
+func generateSubjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	spki, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling public key: %w", err)
+	}
+	id := sha1.Sum(spki)
+	return id[:], nil
+}
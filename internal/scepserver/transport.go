@@ -0,0 +1,98 @@
+package scepserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	kitlog "github.com/go-kit/kit/log"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/groob/finalizer/logutil"
+)
+
+// MakeHTTPHandler builds the /scep HTTP handler, routing both GET (the
+// classic SCEP transport) and POST (SCEPStandard/POSTPKIOperation, used for
+// PKIOperation requests too large for a query string) to e.
+func MakeHTTPHandler(e *Endpoints, svc Service, logger kitlog.Logger) http.Handler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorLogger(logger),
+		kithttp.ServerFinalizer(logutil.NewHTTPLogger(logger).LoggingFinalizer),
+	}
+
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/scep").Handler(kithttp.NewServer(
+		e.GetEndpoint,
+		decodeSCEPRequest,
+		encodeSCEPResponse,
+		opts...,
+	))
+	r.Methods("POST").Path("/scep").Handler(kithttp.NewServer(
+		e.PostEndpoint,
+		decodeSCEPRequest,
+		encodeSCEPResponse,
+		opts...,
+	))
+
+	return r
+}
+
+const maxPayloadSize = 2 << 20
+
+func decodeSCEPRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	msg, err := requestMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	return SCEPRequest{
+		Message:   msg,
+		Operation: r.URL.Query().Get("operation"),
+	}, nil
+}
+
+// requestMessage extracts the SCEP message from r: the base64url-encoded
+// "message" query parameter for GET, or the raw request body for POST.
+func requestMessage(r *http.Request) ([]byte, error) {
+	switch r.Method {
+	case http.MethodGet:
+		return []byte(r.URL.Query().Get("message")), nil
+	case http.MethodPost:
+		return io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	default:
+		return nil, errors.New("scep: method not supported")
+	}
+}
+
+func encodeSCEPResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(SCEPResponse)
+	if resp.Err != nil {
+		http.Error(w, resp.Err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	w.Header().Set("Content-Type", contentHeader(resp.operation, resp.CACertNum))
+	_, err := w.Write(resp.Data)
+	return err
+}
+
+const (
+	certChainHeader = "application/x-x509-ca-ra-cert"
+	leafHeader      = "application/x-x509-ca-cert"
+	pkiOpHeader     = "application/x-pki-message"
+)
+
+func contentHeader(op string, certNum int) string {
+	switch op {
+	case "GetCACert":
+		if certNum > 1 {
+			return certChainHeader
+		}
+		return leafHeader
+	case "PKIOperation":
+		return pkiOpHeader
+	default:
+		return "text/plain"
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	scepserver "go.bog.dev/scep2acme/internal/scepserver"
+
+	"go.bog.dev/scep2acme/internal/reqid"
+)
+
+// requestIDHeader is the header inbound requests use to supply a request ID,
+// and that's echoed back on the response.
+const requestIDHeader = "X-Request-Id"
+
+// withRequestID wraps next so that every request carries a request ID in its
+// context: the inbound X-Request-Id header if present, otherwise a generated
+// UUIDv4. The ID is echoed back on the response header and is available to
+// downstream code (endpoint logging, the ACME certificate source) via
+// reqid.FromContext.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(reqid.WithValue(r.Context(), id)))
+	})
+}
+
+// requestLoggingMiddleware is scepserver.EndpointLoggingMiddleware with the
+// request ID stashed in ctx by withRequestID added as a "request_id" field,
+// so it has to read the request ID per call rather than once at wrap time.
+func requestLoggingMiddleware(logger log.Logger) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			keyvals := []interface{}{"request_id", reqid.FromContext(ctx)}
+			if req, ok := request.(scepserver.SCEPRequest); ok {
+				keyvals = append(keyvals, "op", req.Operation)
+			}
+			defer func(begin time.Time) {
+				logger.Log(append(keyvals, "error", err, "took", time.Since(begin))...)
+			}(time.Now())
+			return next(ctx, request)
+		}
+	}
+}
@@ -11,39 +11,70 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
-	scepserver "github.com/micromdm/scep/server"
 	"go.bog.dev/errpool"
+	scepserver "go.bog.dev/scep2acme/internal/scepserver"
 )
 
+// Reloadable is implemented by components whose configuration can be
+// refreshed in place, without dropping in-flight requests, in response to a
+// SIGHUP.
+type Reloadable interface {
+	Reload() error
+}
+
 // Server manages the HTTP server and graceful shutdown
 type Server struct {
-	addr   string
-	logger log.Logger
+	addr        string
+	logger      log.Logger
+	reloadables []Reloadable
 }
 
-// New creates a new server
-func New(addr string, logger log.Logger) *Server {
+// New creates a new server. Any reloadables passed in have Reload called
+// when the process receives a SIGHUP, instead of the server terminating.
+func New(addr string, logger log.Logger, reloadables ...Reloadable) *Server {
 	return &Server{
-		addr:   addr,
-		logger: logger,
+		addr:        addr,
+		logger:      logger,
+		reloadables: reloadables,
+	}
+}
+
+// reload calls Reload on every registered component, logging the outcome of
+// each.
+func (s *Server) reload() {
+	lginfo := level.Info(s.logger)
+	for _, r := range s.reloadables {
+		if err := r.Reload(); err != nil {
+			lginfo.Log("msg", "reload failed", "err", err)
+			continue
+		}
+		lginfo.Log("msg", "reloaded")
 	}
 }
 
-// Run starts the HTTP server with graceful shutdown
-func (s *Server) Run(svc scepserver.Service) error {
+// Run starts the HTTP server with graceful shutdown. Any background workers
+// passed in run under the same errpool as the HTTP server and signal
+// handling, so they're started together and given the chance to wind down
+// on the same shutdown signal.
+func (s *Server) Run(svc scepserver.Service, background ...func(context.Context) error) error {
 	lginfo := level.Info(s.logger)
 
 	// Create HTTP handler
 	var h http.Handler
 	{
 		e := scepserver.MakeServerEndpoints(svc)
-		e.GetEndpoint = scepserver.EndpointLoggingMiddleware(lginfo)(e.GetEndpoint)
-		e.PostEndpoint = scepserver.EndpointLoggingMiddleware(lginfo)(e.PostEndpoint)
+		e.GetEndpoint = requestLoggingMiddleware(lginfo)(e.GetEndpoint)
+		e.PostEndpoint = requestLoggingMiddleware(lginfo)(e.PostEndpoint)
 		h = scepserver.MakeHTTPHandler(e, svc, log.With(lginfo, "component", "http"))
+		h = withRequestID(h)
 	}
 
 	pool := errpool.Unbounded(context.Background())
 
+	for _, bg := range background {
+		pool.Go(bg)
+	}
+
 	server := http.Server{
 		Addr:              s.addr,
 		Handler:           h,
@@ -66,11 +97,22 @@ func (s *Server) Run(svc scepserver.Service) error {
 		return server.Shutdown(shutdownCtx)
 	})
 
-	// Handle termination signals
+	// Handle termination and reload signals
 	pool.Go(func(ctx context.Context) error {
 		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGTERM)
-		return fmt.Errorf("%v", <-c)
+		signal.Notify(c, syscall.SIGTERM, syscall.SIGHUP)
+		for {
+			select {
+			case sig := <-c:
+				if sig == syscall.SIGHUP {
+					s.reload()
+					continue
+				}
+				return fmt.Errorf("%v", sig)
+			case <-ctx.Done():
+				return nil
+			}
+		}
 	})
 
 	if err := lginfo.Log("terminated", pool.Wait()); err != nil {
@@ -0,0 +1,218 @@
+// Package store persists ACME-issued certificates across SCEP requests and
+// process restarts, keyed by the hostnames they cover - much like Traefik's
+// DomainsCertificates - so a renewal goroutine can keep them fresh without
+// waiting for a SCEP client to ask again.
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is a persisted snapshot of a certificate.Resource, plus the
+// bookkeeping needed to decide when it needs renewing.
+type Record struct {
+	Domain            string    `json:"domain"`
+	SANs              []string  `json:"sans"`
+	CertURL           string    `json:"cert_url"`
+	CertStableURL     string    `json:"cert_stable_url"`
+	AccountURL        string    `json:"account_url"`
+	Profile           string    `json:"profile,omitempty"`
+	Certificate       []byte    `json:"certificate"`
+	IssuerCertificate []byte    `json:"issuer_certificate"`
+	PrivateKey        []byte    `json:"private_key,omitempty"`
+	CSR               []byte    `json:"csr,omitempty"`
+	CSRFingerprint    string    `json:"csr_fingerprint"`
+	IssuedAt          time.Time `json:"issued_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// Valid reports whether r still covers sans and has more than a third of its
+// validity period remaining.
+func (r *Record) Valid(sans []string) bool {
+	if !sameSANs(r.SANs, sans) {
+		return false
+	}
+
+	lifetime := r.ExpiresAt.Sub(r.IssuedAt)
+	if lifetime <= 0 {
+		return false
+	}
+
+	return time.Until(r.ExpiresAt) > lifetime/3
+}
+
+func sameSANs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Key derives a stable lookup key from a sorted, deduplicated set of
+// hostnames, so requests for the same SANs in a different order share a
+// store entry.
+func Key(domains []string) string {
+	sorted := append([]string{}, domains...)
+	sort.Strings(sorted)
+
+	h := sha256.Sum256([]byte(strings.Join(sorted, ",")))
+	return hex.EncodeToString(h[:])
+}
+
+// Store persists Records keyed by Key(domains).
+type Store interface {
+	// Get returns the Record stored for key, if any.
+	Get(key string) (*Record, bool, error)
+	// Put stores rec under key.
+	Put(key string, rec *Record) error
+	// Keys returns every key currently stored, for the renewal scanner.
+	Keys() ([]string, error)
+}
+
+// MemoryStore is an in-memory Store. It does not survive restarts. It's
+// accessed concurrently from per-request goroutines and the background
+// Renewer scan, so records is guarded by mu - matching the mutex the
+// MemoryCache this package replaced already used.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]*Record
+}
+
+// NewMemoryStore creates an empty in-memory Store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]*Record{}}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(key string) (*Record, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[key]
+	return rec, ok, nil
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(key string, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = rec
+	return nil
+}
+
+// Keys implements Store.
+func (s *MemoryStore) Keys() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.records))
+	for key := range s.records {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// FileStore is a Store backed by one JSON file per key under dir, so issued
+// certificates survive restarts. Writes go through a temp file + rename so a
+// crash mid-write can't leave a corrupt entry.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a Store that stores entries under dir, creating it if
+// necessary.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating store dir: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Get implements Store.
+func (s *FileStore) Get(key string) (*Record, bool, error) {
+	data, err := os.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, false, fmt.Errorf("parsing store entry %s: %w", key, err)
+	}
+
+	return &rec, true, nil
+}
+
+// Put implements Store.
+func (s *FileStore) Put(key string, rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encoding store entry: %w", err)
+	}
+
+	path := s.path(key)
+
+	tmp, err := os.CreateTemp(s.dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating temp store file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing store file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing store file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing store file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Keys implements Store.
+func (s *FileStore) Keys() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading store dir: %w", err)
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		keys = append(keys, strings.TrimSuffix(name, ".json"))
+	}
+
+	return keys, nil
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordValid(t *testing.T) {
+	base := Record{SANs: []string{"a.example.com", "b.example.com"}}
+
+	t.Run("fresh record with matching SANs is valid", func(t *testing.T) {
+		rec := base
+		rec.IssuedAt = time.Now().Add(-time.Hour)
+		rec.ExpiresAt = time.Now().Add(100 * time.Hour)
+		require.True(t, rec.Valid(rec.SANs))
+	})
+
+	t.Run("SAN drift invalidates the record", func(t *testing.T) {
+		rec := base
+		rec.IssuedAt = time.Now().Add(-time.Hour)
+		rec.ExpiresAt = time.Now().Add(100 * time.Hour)
+		require.False(t, rec.Valid([]string{"a.example.com", "c.example.com"}))
+	})
+
+	t.Run("SAN order doesn't matter", func(t *testing.T) {
+		rec := base
+		rec.IssuedAt = time.Now().Add(-time.Hour)
+		rec.ExpiresAt = time.Now().Add(100 * time.Hour)
+		require.True(t, rec.Valid([]string{"b.example.com", "a.example.com"}))
+	})
+
+	t.Run("less than a third of lifetime remaining is invalid", func(t *testing.T) {
+		rec := base
+		rec.IssuedAt = time.Now().Add(-80 * time.Hour)
+		rec.ExpiresAt = time.Now().Add(20 * time.Hour) // lifetime 100h, 20h remaining < 1/3
+		require.False(t, rec.Valid(rec.SANs))
+	})
+
+	t.Run("just over a third of lifetime remaining is valid", func(t *testing.T) {
+		rec := base
+		rec.IssuedAt = time.Now().Add(-60 * time.Hour)
+		rec.ExpiresAt = time.Now().Add(40 * time.Hour) // lifetime 100h, 40h remaining > 1/3
+		require.True(t, rec.Valid(rec.SANs))
+	})
+
+	t.Run("zero lifetime is invalid", func(t *testing.T) {
+		rec := base
+		rec.IssuedAt = time.Now()
+		rec.ExpiresAt = time.Now()
+		require.False(t, rec.Valid(rec.SANs))
+	})
+}
+
+func TestKeyIsOrderIndependent(t *testing.T) {
+	require.Equal(t, Key([]string{"a.example.com", "b.example.com"}), Key([]string{"b.example.com", "a.example.com"}))
+	require.NotEqual(t, Key([]string{"a.example.com"}), Key([]string{"a.example.com", "b.example.com"}))
+}
+
+func TestMemoryStoreGetPutKeys(t *testing.T) {
+	s := NewMemoryStore()
+
+	_, ok, err := s.Get("missing")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	rec := &Record{Domain: "a.example.com"}
+	require.NoError(t, s.Put("key-a", rec))
+
+	got, ok, err := s.Get("key-a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, rec, got)
+
+	require.NoError(t, s.Put("key-b", &Record{Domain: "b.example.com"}))
+
+	keys, err := s.Keys()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"key-a", "key-b"}, keys)
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(filepath.Join(dir, "store"))
+	require.NoError(t, err)
+
+	_, ok, err := s.Get("missing")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	rec := &Record{
+		Domain:    "a.example.com",
+		SANs:      []string{"a.example.com"},
+		IssuedAt:  time.Now().Add(-time.Hour).Truncate(time.Second),
+		ExpiresAt: time.Now().Add(100 * time.Hour).Truncate(time.Second),
+	}
+	require.NoError(t, s.Put("key-a", rec))
+
+	got, ok, err := s.Get("key-a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, rec.Domain, got.Domain)
+	require.Equal(t, rec.SANs, got.SANs)
+	require.True(t, rec.IssuedAt.Equal(got.IssuedAt))
+	require.True(t, rec.ExpiresAt.Equal(got.ExpiresAt))
+
+	require.NoError(t, s.Put("key-b", &Record{Domain: "b.example.com"}))
+
+	keys, err := s.Keys()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"key-a", "key-b"}, keys)
+}
+
+func TestFileStorePutOverwritesExistingKey(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Put("key-a", &Record{Domain: "old.example.com"}))
+	require.NoError(t, s.Put("key-a", &Record{Domain: "new.example.com"}))
+
+	got, ok, err := s.Get("key-a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "new.example.com", got.Domain)
+
+	keys, err := s.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"key-a"}, keys)
+}
@@ -0,0 +1,126 @@
+package whitelist
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Decision is the outcome of CSRPasswordVerifier.Verify for a single CSR,
+// passed to the configured AuditSink. PasswordID and Fingerprint are derived
+// (see passwordID/csrFingerprint), not raw secrets or key material, so a
+// sink can log or forward Decision values without itself handling anything
+// sensitive.
+type Decision struct {
+	Allowed     bool
+	Reason      string
+	PasswordID  string
+	CN          string
+	SANs        []string
+	Fingerprint string
+}
+
+// AuditSink receives every CSR verification Decision, for feeding an
+// external SIEM or audit trail. Record is called synchronously from Verify;
+// implementations that talk to a remote system should apply their own
+// timeout via ctx.
+type AuditSink interface {
+	Record(ctx context.Context, decision Decision, csr *x509.CertificateRequest) error
+}
+
+// NoopAuditSink discards every Decision. It's the default AuditSink for a
+// CSRPasswordVerifier constructed without WithAuditSink.
+type NoopAuditSink struct{}
+
+// Record implements AuditSink.
+func (NoopAuditSink) Record(context.Context, Decision, *x509.CertificateRequest) error {
+	return nil
+}
+
+// FileAuditSink appends each Decision as a JSON line to a file, so an
+// external agent (e.g. a SIEM's log shipper) can tail it.
+type FileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditSink opens path for appending, creating it (mode 0o600) if it
+// doesn't already exist.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	return &FileAuditSink{file: f}, nil
+}
+
+// auditRecord is the JSON-lines wire format FileAuditSink writes.
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	Allowed     bool      `json:"allowed"`
+	Reason      string    `json:"reason,omitempty"`
+	PasswordID  string    `json:"password_id"`
+	CN          string    `json:"cn"`
+	SANs        []string  `json:"sans,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+}
+
+// Record implements AuditSink.
+func (s *FileAuditSink) Record(_ context.Context, decision Decision, _ *x509.CertificateRequest) error {
+	data, err := json.Marshal(auditRecord{
+		Time:        time.Now(),
+		Allowed:     decision.Allowed,
+		Reason:      decision.Reason,
+		PasswordID:  decision.PasswordID,
+		CN:          decision.CN,
+		SANs:        decision.SANs,
+		Fingerprint: decision.Fingerprint,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding audit record: %w", err)
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(data)
+	return err
+}
+
+// Close closes the underlying file.
+func (s *FileAuditSink) Close() error {
+	return s.file.Close()
+}
+
+var _ AuditSink = NoopAuditSink{}
+var _ AuditSink = (*FileAuditSink)(nil)
+
+// fingerprintLen is how many hex characters of a SHA-256 digest
+// passwordID/csrFingerprint keep - enough to distinguish values in a log
+// without printing a full digest.
+const fingerprintLen = 12
+
+// passwordID returns a short, non-reversible identifier for a challenge
+// password, so it can appear in logs and audit records without exposing the
+// password itself.
+func passwordID(password string) string {
+	return fingerprint([]byte(password))
+}
+
+// csrFingerprint returns a short fingerprint of a CSR's raw DER, letting
+// logs/audit records distinguish requests without dumping the parsed CSR
+// (and its public key) as whitelist.Verify used to.
+func csrFingerprint(csr *x509.CertificateRequest) string {
+	return fingerprint(csr.Raw)
+}
+
+func fingerprint(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:fingerprintLen]
+}
@@ -0,0 +1,170 @@
+package whitelist
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+
+	"go.bog.dev/scep2acme/internal/idn"
+)
+
+// IPMatcher is a function that checks if an IP address matches a pattern.
+type IPMatcher func(ip net.IP) bool
+
+// matcher is the parsed form of one whitelist.yaml matcher entry. Host is
+// used against CSR CommonName/DNSNames/EmailAddresses; it's nil for a cidr
+// entry, which only ever matches IP SANs via IP instead.
+type matcher struct {
+	Host HostnameMatcher
+	IP   IPMatcher
+}
+
+// DefaultProfile is the ACME profile used by whitelist entries that don't
+// name one explicitly, and the key under which the single ACME client built
+// from the top-level -acme* flags is registered when -profiles isn't set.
+const DefaultProfile = "default"
+
+// parseEntry builds the matcher and target ACME profile described by one
+// whitelist.yaml list entry. Most entries are a bare matcher (see
+// parseMatcher) and route to DefaultProfile; a {host: <matcher>, profile:
+// <name>} map additionally selects a named profile from a -profiles file,
+// letting different hostnames route to different ACME directories/accounts.
+func parseEntry(item interface{}) (matcher, string, error) {
+	if m, ok := item.(map[interface{}]interface{}); ok {
+		if hostVal, ok := m["host"]; ok {
+			profile := DefaultProfile
+			if profileVal, ok := m["profile"]; ok {
+				p, ok := profileVal.(string)
+				if !ok {
+					return matcher{}, "", fmt.Errorf("profile %v is not a string", profileVal)
+				}
+				profile = p
+			}
+
+			mt, err := parseMatcher(hostVal)
+			if err != nil {
+				return matcher{}, "", err
+			}
+			return mt, profile, nil
+		}
+	}
+
+	mt, err := parseMatcher(item)
+	return mt, DefaultProfile, err
+}
+
+// parseMatcher builds the matcher described by a single whitelist.yaml
+// entry. A bare string is an exact hostname match, for backwards
+// compatibility; a single-key map selects one of "exact", "suffix", "glob",
+// "regex" (all matched against CSR CommonName/DNSNames/EmailAddresses) or
+// "cidr" (matched against CSR IPAddresses only).
+func parseMatcher(item interface{}) (matcher, error) {
+	switch v := item.(type) {
+	case string:
+		return matcher{Host: hostnameExactMatcher(v)}, nil
+	case map[interface{}]interface{}:
+		if len(v) != 1 {
+			return matcher{}, fmt.Errorf("matcher entry must have exactly one key: %v", v)
+		}
+
+		for key, value := range v {
+			kind, ok := key.(string)
+			if !ok {
+				return matcher{}, fmt.Errorf("matcher key %v is not a string", key)
+			}
+
+			pattern, ok := value.(string)
+			if !ok {
+				return matcher{}, fmt.Errorf("matcher %q value %v is not a string", kind, value)
+			}
+
+			switch kind {
+			case "exact":
+				return matcher{Host: hostnameExactMatcher(pattern)}, nil
+			case "suffix":
+				return matcher{Host: hostnameSuffixMatcher(pattern)}, nil
+			case "glob":
+				host, err := hostnameGlobMatcher(pattern)
+				return matcher{Host: host}, err
+			case "regex":
+				host, err := hostnameRegexMatcher(pattern)
+				return matcher{Host: host}, err
+			case "cidr":
+				ip, err := cidrMatcher(pattern)
+				return matcher{IP: ip}, err
+			default:
+				return matcher{}, fmt.Errorf("unknown matcher type %q", kind)
+			}
+		}
+
+		panic("unreachable")
+	default:
+		return matcher{}, fmt.Errorf("unknown item: %v (type %T)", item, item)
+	}
+}
+
+// hostnameSuffixMatcher matches hostname equal to, or a dotted subdomain of,
+// suffix. A leading "." on suffix is ignored, so "suffix: .example.com" and
+// "suffix: example.com" behave the same - both require a "." boundary, so
+// "evilexample.com" does not match "example.com". suffix is normalized to
+// ASCII/punycode at construction time, to match allowedDNSName/Profile
+// comparing hostname in the same form.
+func hostnameSuffixMatcher(suffix string) HostnameMatcher {
+	suffix = idn.ToASCII(strings.TrimPrefix(suffix, "."))
+	return func(hostname string) bool {
+		return hostname == suffix || strings.HasSuffix(hostname, "."+suffix)
+	}
+}
+
+// hostnameGlobMatcher compiles a glob pattern using path.Match semantics,
+// with "." standing in for "/" so that "*" matches within a single hostname
+// label rather than crossing dots.
+func hostnameGlobMatcher(pattern string) (HostnameMatcher, error) {
+	pathPattern := strings.ReplaceAll(pattern, ".", "/")
+
+	if _, err := path.Match(pathPattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+
+	return func(hostname string) bool {
+		matched, _ := path.Match(pathPattern, strings.ReplaceAll(hostname, ".", "/"))
+		return matched
+	}, nil
+}
+
+// hostnameRegexMatcher compiles pattern, anchoring it to the full hostname
+// if the caller didn't already anchor it.
+func hostnameRegexMatcher(pattern string) (HostnameMatcher, error) {
+	if !strings.HasPrefix(pattern, "^") {
+		pattern = "^" + pattern
+	}
+	if !strings.HasSuffix(pattern, "$") {
+		pattern += "$"
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", pattern, err)
+	}
+
+	return func(hostname string) bool {
+		return re.MatchString(hostname)
+	}, nil
+}
+
+// cidrMatcher matches an IP SAN falling within cidr, e.g. "10.0.0.0/8". It's
+// the only matcher kind evaluated against csr.IPAddresses - the string
+// matchers above are only ever checked against DNS names and email
+// addresses.
+func cidrMatcher(cidr string) (IPMatcher, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cidr %q: %w", cidr, err)
+	}
+
+	return func(ip net.IP) bool {
+		return ipNet.Contains(ip)
+	}, nil
+}
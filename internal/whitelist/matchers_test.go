@@ -0,0 +1,38 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCidrMatcher(t *testing.T) {
+	m, err := cidrMatcher("10.0.0.0/24")
+	require.NoError(t, err)
+
+	require.True(t, m(net.ParseIP("10.0.0.42")))
+	require.False(t, m(net.ParseIP("10.0.1.42")))
+	require.False(t, m(net.ParseIP("192.168.0.1")))
+}
+
+func TestCidrMatcherInvalid(t *testing.T) {
+	_, err := cidrMatcher("not-a-cidr")
+	require.Error(t, err)
+}
+
+func TestParseMatcherCidrHasNoHostMatcher(t *testing.T) {
+	mt, err := parseMatcher(map[interface{}]interface{}{"cidr": "10.0.0.0/8"})
+	require.NoError(t, err)
+	require.Nil(t, mt.Host)
+	require.NotNil(t, mt.IP)
+	require.True(t, mt.IP(net.ParseIP("10.1.2.3")))
+}
+
+func TestHostnameExactMatcher(t *testing.T) {
+	m := hostnameExactMatcher("host.example.com")
+
+	require.True(t, m("host.example.com"))
+	require.False(t, m("other.example.com"))
+	require.False(t, m("notthehost.example.com"))
+}
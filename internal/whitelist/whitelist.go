@@ -1,34 +1,140 @@
 package whitelist
 
 import (
+	"context"
 	"crypto/x509"
 	"fmt"
+	"net"
 	"os"
-	"reflect"
+	"strings"
+	"sync/atomic"
 
-	"github.com/micromdm/scep/crypto/x509util"
-	"github.com/micromdm/scep/csrverifier"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/smallstep/scep/x509util"
+	"go.bog.dev/scep2acme/internal/scepserver"
+	"golang.org/x/sync/singleflight"
 	"gopkg.in/yaml.v2"
+
+	"go.bog.dev/scep2acme/internal/idn"
 )
 
 // HostnameMatcher is a function that checks if a hostname matches a pattern
 type HostnameMatcher func(hostname string) bool
 
-// CSRPasswordVerifier verifies CSRs based on password-hostname mapping
+// rule is one parsed whitelist.yaml list entry: a matcher (see matcher) plus
+// the ACME profile (see DefaultProfile) it routes to.
+type rule struct {
+	matcher matcher
+	profile string
+}
+
+// ruleset holds one parsed snapshot of whitelist.yaml - which hostnames each
+// challenge password is allowed to claim, and which ACME profile each is
+// routed to.
+type ruleset struct {
+	passwordRules map[string][]rule
+	numRules      int
+}
+
+// CSRPasswordVerifier verifies CSRs based on password-hostname mapping. Its
+// ruleset is held behind an atomic pointer so Reload can swap in a freshly
+// parsed whitelist file without disrupting CSRs being verified concurrently.
 type CSRPasswordVerifier struct {
-	passwordMatchers map[string][]HostnameMatcher
+	path      string
+	rules     atomic.Pointer[ruleset]
+	group     singleflight.Group
+	logger    log.Logger
+	auditSink AuditSink
+}
+
+// Option configures a CSRPasswordVerifier constructed by
+// NewCSRPasswordVerifier.
+type Option func(*CSRPasswordVerifier)
+
+// WithLogger configures the go-kit logger that CSRPasswordVerifier logs
+// verification decisions and reloads to. Denials are logged at level.Warn,
+// approvals and reloads at level.Info. By default, decisions aren't logged.
+func WithLogger(logger log.Logger) Option {
+	return func(c *CSRPasswordVerifier) {
+		c.logger = logger
+	}
 }
 
-// allowedDNSName checks if a DNS name is allowed for the given password
+// WithAuditSink configures the AuditSink that receives every CSR
+// verification decision. By default, decisions are discarded.
+func WithAuditSink(sink AuditSink) Option {
+	return func(c *CSRPasswordVerifier) {
+		c.auditSink = sink
+	}
+}
+
+// allowedDNSName checks if a DNS name is allowed for the given password.
+// dnsName is compared in its ASCII/punycode form, so a whitelist entry
+// written as Unicode or punycode matches a CSR hostname written in either
+// form, and vice versa. Rules with no Host matcher (cidr entries) never
+// match here.
 func (c *CSRPasswordVerifier) allowedDNSName(password string, dnsName string) bool {
-	for _, matcher := range c.passwordMatchers[password] {
-		if matcher(dnsName) {
+	dnsName = idn.ToASCII(dnsName)
+	for _, r := range c.rules.Load().passwordRules[password] {
+		if r.matcher.Host != nil && r.matcher.Host(dnsName) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedEmail checks if an email address SAN is allowed for the given
+// password, against the same Host matchers as allowedDNSName. Unlike
+// hostnames, the email is compared as-is - IDN normalization doesn't apply
+// to the local part of an address, and idn.ToASCII leaves a non-hostname
+// string unchanged anyway.
+func (c *CSRPasswordVerifier) allowedEmail(password string, email string) bool {
+	for _, r := range c.rules.Load().passwordRules[password] {
+		if r.matcher.Host != nil && r.matcher.Host(email) {
 			return true
 		}
 	}
 	return false
 }
 
+// allowedIP checks if an IP address SAN is allowed for the given password,
+// against cidr matchers only.
+func (c *CSRPasswordVerifier) allowedIP(password string, ip net.IP) bool {
+	for _, r := range c.rules.Load().passwordRules[password] {
+		if r.matcher.IP != nil && r.matcher.IP(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Profile returns the ACME profile that a CSR presenting password should be
+// routed to, given names - typically its CommonName plus its SANs. It's the
+// profile attached to the first whitelist rule, in file order, whose
+// matcher accepts every one of names; ok is false if no single rule covers
+// the whole CSR, in which case callers should fall back to DefaultProfile.
+// Verify is still what decides whether the request is allowed at all -
+// Profile only disambiguates which ACME client serves it.
+func (c *CSRPasswordVerifier) Profile(password string, names []string) (profile string, ok bool) {
+	for _, r := range c.rules.Load().passwordRules[password] {
+		if r.matcher.Host == nil {
+			continue
+		}
+		coversAll := true
+		for _, name := range names {
+			if !r.matcher.Host(idn.ToASCII(name)) {
+				coversAll = false
+				break
+			}
+		}
+		if coversAll {
+			return r.profile, true
+		}
+	}
+	return DefaultProfile, false
+}
+
 // Verify implements the CSRVerifier interface
 func (c *CSRPasswordVerifier) Verify(data []byte) (bool, error) {
 	cp, err := x509util.ParseChallengePassword(data)
@@ -41,32 +147,141 @@ func (c *CSRPasswordVerifier) Verify(data []byte) (bool, error) {
 		return false, err
 	}
 
+	// Verify has no context of its own - scepserver.CSRVerifier doesn't
+	// carry one through from the SCEP request - so audit records for this
+	// decision aren't attributable to a caller-supplied deadline/trace.
+	ctx := context.Background()
+	pwID := passwordID(cp)
+
 	if !c.allowedDNSName(cp, csr.Subject.CommonName) {
-		fmt.Printf("Subject CN not allowed: %v\n", csr.Subject.CommonName)
-		return false, nil
+		return c.deny(ctx, csr, pwID, csr.Subject.CommonName, "CN not allowed")
 	}
 
 	for _, name := range csr.DNSNames {
 		if !c.allowedDNSName(cp, name) {
-			fmt.Printf("SAN not allowed: %v\n", name)
-			return false, nil
+			return c.deny(ctx, csr, pwID, name, "DNS SAN not allowed")
 		}
 	}
 
-	fmt.Printf("CSR passed verification: %+v\n", csr)
+	for _, ip := range csr.IPAddresses {
+		if !c.allowedIP(cp, ip) {
+			return c.deny(ctx, csr, pwID, ip.String(), "IP SAN not allowed")
+		}
+	}
+
+	for _, email := range csr.EmailAddresses {
+		if !c.allowedEmail(cp, email) {
+			return c.deny(ctx, csr, pwID, email, "email SAN not allowed")
+		}
+	}
+
+	return c.approve(ctx, csr, pwID)
+}
+
+// deny logs a rejected CSR at level.Warn, records it to the configured
+// AuditSink, and returns the (false, nil) Verify expects for a rejection.
+// failedName is whichever CN/SAN tripped the matcher, not the full CSR - a
+// CSR's public key is never logged.
+func (c *CSRPasswordVerifier) deny(ctx context.Context, csr *x509.CertificateRequest, pwID, failedName, reason string) (bool, error) {
+	level.Warn(c.logger).Log(
+		"msg", "CSR denied",
+		"password_id", pwID,
+		"cn", csr.Subject.CommonName,
+		"san", failedName,
+		"reason", reason,
+	)
+
+	c.record(ctx, Decision{
+		Allowed:     false,
+		Reason:      reason,
+		PasswordID:  pwID,
+		CN:          csr.Subject.CommonName,
+		SANs:        csrSANs(csr),
+		Fingerprint: csrFingerprint(csr),
+	}, csr)
+
+	return false, nil
+}
+
+// approve logs an accepted CSR at level.Info and records it to the
+// configured AuditSink. Unlike the previous fmt.Printf("%+v", csr), it logs
+// a short fingerprint of the CSR rather than dumping it - including its
+// public key - in full.
+func (c *CSRPasswordVerifier) approve(ctx context.Context, csr *x509.CertificateRequest, pwID string) (bool, error) {
+	sans := csrSANs(csr)
+	fingerprint := csrFingerprint(csr)
+	level.Info(c.logger).Log(
+		"msg", "CSR approved",
+		"cn", csr.Subject.CommonName,
+		"sans", strings.Join(sans, ","),
+		"fingerprint", fingerprint,
+	)
+
+	c.record(ctx, Decision{
+		Allowed:     true,
+		PasswordID:  pwID,
+		CN:          csr.Subject.CommonName,
+		SANs:        sans,
+		Fingerprint: fingerprint,
+	}, csr)
 
 	return true, nil
 }
 
-// hostnameExactMatcher creates a matcher that checks for exact hostname matches
+// record forwards decision to the configured AuditSink, logging (but not
+// returning) any error - a SIEM being unreachable shouldn't fail SCEP
+// enrollment.
+func (c *CSRPasswordVerifier) record(ctx context.Context, decision Decision, csr *x509.CertificateRequest) {
+	if err := c.auditSink.Record(ctx, decision, csr); err != nil {
+		level.Warn(c.logger).Log("msg", "audit sink record failed", "err", err)
+	}
+}
+
+// csrSANs collects every SAN kind Verify checks into one slice, for logging
+// and audit records.
+func csrSANs(csr *x509.CertificateRequest) []string {
+	sans := make([]string, 0, len(csr.DNSNames)+len(csr.IPAddresses)+len(csr.EmailAddresses))
+	sans = append(sans, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, csr.EmailAddresses...)
+	return sans
+}
+
+// Reload re-parses the whitelist file at path and atomically swaps it in.
+// Concurrent calls (e.g. repeated SIGHUPs) share a single re-parse via a
+// singleflight.Group. On parse failure the previous ruleset is left in
+// place and the error is returned.
+func (c *CSRPasswordVerifier) Reload() error {
+	_, err, _ := c.group.Do("reload", func() (interface{}, error) {
+		rules, err := loadRuleset(c.path)
+		if err != nil {
+			return nil, err
+		}
+
+		c.rules.Store(rules)
+		level.Info(c.logger).Log("msg", "whitelist reloaded", "rules", rules.numRules)
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// hostnameExactMatcher creates a matcher that checks for exact hostname
+// matches. name is normalized to ASCII/punycode at construction time, to
+// match allowedDNSName/Profile comparing hostname in the same form.
 func hostnameExactMatcher(name string) HostnameMatcher {
+	name = idn.ToASCII(name)
 	return func(hostname string) bool {
 		return name == hostname
 	}
 }
 
-// NewCSRPasswordVerifier creates a new CSRPasswordVerifier from a YAML file
-func NewCSRPasswordVerifier(yamlPath string) (csrverifier.CSRVerifier, error) {
+// loadRuleset reads and parses yamlPath into a ruleset. See parseEntry for
+// the matcher and profile-selection syntax supported by each entry.
+func loadRuleset(yamlPath string) (*ruleset, error) {
 	data, err := os.ReadFile(yamlPath)
 	if err != nil {
 		return nil, fmt.Errorf("reading file: %w", err)
@@ -78,8 +293,8 @@ func NewCSRPasswordVerifier(yamlPath string) (csrverifier.CSRVerifier, error) {
 		return nil, fmt.Errorf("parsing file: %w", err)
 	}
 
-	c := &CSRPasswordVerifier{
-		passwordMatchers: map[string][]HostnameMatcher{},
+	rules := &ruleset{
+		passwordRules: map[string][]rule{},
 	}
 
 	for pass, value := range mapping {
@@ -90,14 +305,36 @@ func NewCSRPasswordVerifier(yamlPath string) (csrverifier.CSRVerifier, error) {
 		}
 
 		for _, item := range items {
-			switch v := item.(type) {
-			case string:
-				c.passwordMatchers[pass] = append(c.passwordMatchers[pass], hostnameExactMatcher(v))
-			default:
-				return nil, fmt.Errorf("unknown item: %v (type %v)", item, reflect.TypeOf(item))
+			matcher, profile, err := parseEntry(item)
+			if err != nil {
+				return nil, err
 			}
+			rules.passwordRules[pass] = append(rules.passwordRules[pass], rule{matcher: matcher, profile: profile})
+			rules.numRules++
 		}
 	}
 
+	return rules, nil
+}
+
+// NewCSRPasswordVerifier creates a new CSRPasswordVerifier from a YAML file.
+// By default it logs nothing and discards every decision; pass WithLogger
+// and/or WithAuditSink to change that.
+func NewCSRPasswordVerifier(yamlPath string, opts ...Option) (*CSRPasswordVerifier, error) {
+	c := &CSRPasswordVerifier{
+		path:      yamlPath,
+		logger:    log.NewNopLogger(),
+		auditSink: NoopAuditSink{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
+
+var _ scepserver.CSRVerifier = (*CSRPasswordVerifier)(nil)
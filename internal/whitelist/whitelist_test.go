@@ -0,0 +1,147 @@
+package whitelist
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/scep/x509util"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCSR builds a CSR with a challengePassword attribute, so it can be
+// parsed by CSRPasswordVerifier.Verify exactly as a real SCEP PKIMessage's
+// pkiEnvelope would be.
+func newTestCSR(t *testing.T, password, cn string, dnsNames []string, ips []net.IP, emails []string) []byte {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509util.CertificateRequest{
+		CertificateRequest: x509.CertificateRequest{
+			Subject:        pkix.Name{CommonName: cn},
+			DNSNames:       dnsNames,
+			IPAddresses:    ips,
+			EmailAddresses: emails,
+		},
+		ChallengePassword: password,
+	}
+
+	csr, err := x509util.CreateCertificateRequest(rand.Reader, template, key)
+	require.NoError(t, err)
+
+	return csr
+}
+
+func newTestVerifier(t *testing.T, yaml string) *CSRPasswordVerifier {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "whitelist.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o600))
+
+	v, err := NewCSRPasswordVerifier(path)
+	require.NoError(t, err)
+
+	return v
+}
+
+func TestVerifyCidrAllowsIPWithinRangeOnly(t *testing.T) {
+	// A cidr entry's matcher has no Host half, so it never satisfies the CN
+	// check on its own - a password also needs a Host rule covering the
+	// CSR's CommonName, exactly as whitelist.yaml would in practice.
+	v := newTestVerifier(t, `
+secret:
+  - exact: host.example.com
+  - cidr: 10.0.0.0/24
+`)
+
+	allowed := newTestCSR(t, "secret", "host.example.com", nil, []net.IP{net.ParseIP("10.0.0.5")}, nil)
+	ok, err := v.Verify(allowed)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	denied := newTestCSR(t, "secret", "host.example.com", nil, []net.IP{net.ParseIP("10.0.1.5")}, nil)
+	ok, err = v.Verify(denied)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestVerifyExactMatcherDoesNotAllowEmail(t *testing.T) {
+	// "exact" (and every other Host matcher) is checked against CN/DNSNames
+	// and EmailAddresses alike - a whitelist entry naming a hostname does
+	// not also authorize an email SAN with a different local part@domain.
+	v := newTestVerifier(t, `
+secret:
+  - exact: host.example.com
+`)
+
+	allowed := newTestCSR(t, "secret", "host.example.com", nil, nil, nil)
+	ok, err := v.Verify(allowed)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	denied := newTestCSR(t, "secret", "host.example.com", nil, nil, []string{"user@example.com"})
+	ok, err = v.Verify(denied)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestVerifyEmailMatcherAllowsListedAddressOnly(t *testing.T) {
+	v := newTestVerifier(t, `
+secret:
+  - exact: host.example.com
+  - exact: user@example.com
+`)
+
+	allowed := newTestCSR(t, "secret", "host.example.com", nil, nil, []string{"user@example.com"})
+	ok, err := v.Verify(allowed)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	denied := newTestCSR(t, "secret", "host.example.com", nil, nil, []string{"other@example.com"})
+	ok, err = v.Verify(denied)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestVerifyDeniesUnlistedIPSAN(t *testing.T) {
+	v := newTestVerifier(t, `
+secret:
+  - exact: host.example.com
+`)
+
+	denied := newTestCSR(t, "secret", "host.example.com", nil, []net.IP{net.ParseIP("10.0.0.1")}, nil)
+	ok, err := v.Verify(denied)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestVerifyDeniesUnlistedEmailSAN(t *testing.T) {
+	v := newTestVerifier(t, `
+secret:
+  - exact: host.example.com
+`)
+
+	denied := newTestCSR(t, "secret", "host.example.com", nil, nil, []string{"user@example.com"})
+	ok, err := v.Verify(denied)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestVerifyUnknownPasswordDeniesEverything(t *testing.T) {
+	v := newTestVerifier(t, `
+secret:
+  - exact: host.example.com
+`)
+
+	denied := newTestCSR(t, "wrong-password", "host.example.com", nil, nil, nil)
+	ok, err := v.Verify(denied)
+	require.NoError(t, err)
+	require.False(t, ok)
+}